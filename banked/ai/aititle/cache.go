@@ -0,0 +1,144 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package aititle
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Cache 标题建议缓存，key 由 Service 按 bvid 和提示词版本生成
+type Cache interface {
+	Get(ctx context.Context, key string) (string, bool)
+	Set(ctx context.Context, key string, value string, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// LRUCache 进程内缓存，超过容量时淘汰最久未使用的条目
+type LRUCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key      string
+	value    string
+	expireAt time.Time
+}
+
+// NewLRUCache 创建容量为 size 的 LRU 缓存，size 不大于 0 时为 1000
+func NewLRUCache(size int) *LRUCache {
+	if size <= 0 {
+		size = 1000
+	}
+	return &LRUCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (c *LRUCache) Get(ctx context.Context, key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+	e := el.Value.(*lruEntry)
+	if !e.expireAt.IsZero() && time.Now().After(e.expireAt) {
+		c.ll.Remove(el)
+		delete(c.items, key)
+		return "", false
+	}
+	c.ll.MoveToFront(el)
+	return e.value, true
+}
+
+func (c *LRUCache) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	var expireAt time.Time
+	if ttl > 0 {
+		expireAt = time.Now().Add(ttl)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*lruEntry)
+		e.value, e.expireAt = value, expireAt
+		c.ll.MoveToFront(el)
+		return nil
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value, expireAt: expireAt})
+	for c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+func (c *LRUCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.ll.Remove(el)
+		delete(c.items, key)
+	}
+	return nil
+}
+
+// RedisCache 多个副本共享、重启后仍然有效的缓存
+type RedisCache struct {
+	rdb    *redis.Client
+	prefix string
+}
+
+// NewRedisCache 创建 Redis 缓存，key 统一加上 prefix
+func NewRedisCache(rdb *redis.Client, prefix string) *RedisCache {
+	return &RedisCache{rdb: rdb, prefix: prefix}
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) (string, bool) {
+	v, err := c.rdb.Get(ctx, c.prefix+key).Result()
+	if err != nil {
+		return "", false
+	}
+	return v, true
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	return c.rdb.Set(ctx, c.prefix+key, value, ttl).Err()
+}
+
+func (c *RedisCache) Delete(ctx context.Context, key string) error {
+	err := c.rdb.Del(ctx, c.prefix+key).Err()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	return err
+}
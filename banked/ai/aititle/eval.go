@@ -0,0 +1,220 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package aititle
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// EvalSample 标注数据：标题、简介和期望的歌名
+type EvalSample struct {
+	Title    string `json:"title"`
+	Desc     string `json:"desc"`
+	Expected string `json:"expected"`
+}
+
+// EvalResult 单条样本的评估结果
+type EvalResult struct {
+	EvalSample
+	Got     string        `json:"got"`
+	Method  string        `json:"method,omitempty"`
+	Exact   bool          `json:"exact"`
+	Fuzzy   bool          `json:"fuzzy"`
+	Latency time.Duration `json:"latency"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// EvalReport 评估汇总
+type EvalReport struct {
+	PromptVersion string        `json:"promptVersion"`
+	Total         int           `json:"total"`
+	Exact         int           `json:"exact"`
+	Fuzzy         int           `json:"fuzzy"`
+	Errors        int           `json:"errors"`
+	ExactAccuracy float64       `json:"exactAccuracy"`
+	FuzzyAccuracy float64       `json:"fuzzyAccuracy"`
+	AvgLatency    time.Duration `json:"avgLatency"`
+	P50Latency    time.Duration `json:"p50Latency"`
+	P95Latency    time.Duration `json:"p95Latency"`
+	Results       []EvalResult  `json:"results"`
+}
+
+// EvalOptions 评估参数
+type EvalOptions struct {
+	Prompt   *PromptTemplate // 为空时使用内置模板
+	Timeout  time.Duration   // 单条超时，默认 2 分钟
+	UseRules bool            // 先走规则解析，与线上行为一致；否则只评估大模型
+}
+
+// LoadEvalDataset 读取 JSONL 格式的标注数据，每行一个 EvalSample，空行和 # 开头的行忽略
+func LoadEvalDataset(path string) ([]EvalSample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var samples []EvalSample
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		var s EvalSample
+		if err := json.Unmarshal([]byte(text), &s); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if s.Title == "" || s.Expected == "" {
+			return nil, fmt.Errorf("line %d: title and expected are required", line)
+		}
+		samples = append(samples, s)
+	}
+	return samples, sc.Err()
+}
+
+// Evaluate 逐条调用 Provider 并统计精确/模糊匹配准确率和耗时，不使用缓存
+func Evaluate(ctx context.Context, p Provider, samples []EvalSample, opts EvalOptions) EvalReport {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Minute
+	}
+	s := NewService(p, ServerConfig{Timeout: opts.Timeout, Prompt: opts.Prompt}, NewLRUCache(1))
+
+	report := EvalReport{PromptVersion: s.PromptVersion(), Total: len(samples)}
+	latencies := make([]time.Duration, 0, len(samples))
+	var sum time.Duration
+	for i, sample := range samples {
+		bvid := fmt.Sprintf("eval-%d", i)
+		question := "标题：" + sample.Title + "\n简介：" + sample.Desc
+		r := EvalResult{EvalSample: sample}
+
+		start := time.Now()
+		if opts.UseRules {
+			sg, err := s.SuggestWithRules(ctx, bvid, sample.Title, question)
+			r.Got, r.Method = sg.Title, sg.Method
+			if err != nil {
+				r.Error = err.Error()
+			}
+		} else {
+			got, err := s.Suggest(ctx, bvid, question)
+			r.Got, r.Method = got, MethodLLM
+			if err != nil {
+				r.Error = err.Error()
+			}
+		}
+		r.Latency = time.Since(start)
+
+		if r.Error != "" {
+			report.Errors++
+		} else {
+			r.Exact = strings.TrimSpace(r.Got) == strings.TrimSpace(sample.Expected)
+			r.Fuzzy = FuzzyMatch(r.Got, sample.Expected)
+		}
+		if r.Exact {
+			report.Exact++
+		}
+		if r.Fuzzy {
+			report.Fuzzy++
+		}
+		latencies = append(latencies, r.Latency)
+		sum += r.Latency
+		report.Results = append(report.Results, r)
+	}
+
+	if report.Total > 0 {
+		report.ExactAccuracy = float64(report.Exact) / float64(report.Total)
+		report.FuzzyAccuracy = float64(report.Fuzzy) / float64(report.Total)
+		report.AvgLatency = sum / time.Duration(report.Total)
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		report.P50Latency = percentile(latencies, 0.5)
+		report.P95Latency = percentile(latencies, 0.95)
+	}
+	return report
+}
+
+// Summary 单行汇总，便于 CLI 和测试输出
+func (r EvalReport) Summary() string {
+	return fmt.Sprintf("prompt=%s total=%d exact=%d(%.1f%%) fuzzy=%d(%.1f%%) errors=%d avg=%s p50=%s p95=%s",
+		r.PromptVersion, r.Total,
+		r.Exact, r.ExactAccuracy*100,
+		r.Fuzzy, r.FuzzyAccuracy*100,
+		r.Errors,
+		r.AvgLatency.Round(time.Millisecond), r.P50Latency.Round(time.Millisecond), r.P95Latency.Round(time.Millisecond))
+}
+
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted)-1) * q)
+	return sorted[idx]
+}
+
+// FuzzyMatch 忽略大小写、空白、标点和书名号后比较；一方包含另一方或编辑距离足够小时也算匹配
+func FuzzyMatch(got, expected string) bool {
+	a, b := normalizeTitle(got), normalizeTitle(expected)
+	if a == "" || b == "" {
+		return false
+	}
+	if a == b || strings.Contains(a, b) || strings.Contains(b, a) {
+		return true
+	}
+	return similarity(a, b) >= 0.8
+}
+
+func normalizeTitle(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
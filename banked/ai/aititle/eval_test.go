@@ -0,0 +1,86 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package aititle
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"bvtc/log"
+
+	"go.uber.org/zap"
+)
+
+type providerFunc func(ctx context.Context, prompt string) (string, error)
+
+func (f providerFunc) CompleteText(ctx context.Context, prompt string) (string, error) {
+	return f(ctx, prompt)
+}
+
+func TestEvaluate(t *testing.T) {
+	log.Logger = zap.NewNop()
+	samples, err := LoadEvalDataset("testdata/titles.jsonl")
+	if err != nil {
+		t.Fatalf("load dataset failed: %v", err)
+	}
+	answers := make(map[string]string, len(samples))
+	for _, s := range samples {
+		answers[s.Title] = s.Expected
+	}
+	// 按提示词中的标题返回标注答案，模拟一个完全准确的模型
+	oracle := providerFunc(func(ctx context.Context, prompt string) (string, error) {
+		i := strings.LastIndex(prompt, "标题：")
+		title, _, _ := strings.Cut(prompt[i+len("标题："):], "\n")
+		return "《" + answers[title] + "》", nil
+	})
+
+	prompt, err := LoadPrompt("../../config/prompts/title.example.yaml")
+	if err != nil {
+		t.Fatalf("load prompt failed: %v", err)
+	}
+	report := Evaluate(context.Background(), oracle, samples, EvalOptions{Prompt: prompt})
+	if report.Total != len(samples) || report.Errors != 0 || report.Fuzzy != report.Total {
+		t.Fatalf("unexpected report: %s", report.Summary())
+	}
+	if report.PromptVersion != prompt.Version {
+		t.Fatalf("unexpected prompt version %q", report.PromptVersion)
+	}
+	t.Log(report.Summary())
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	cases := []struct {
+		got, expected string
+		want          bool
+	}{
+		{"《晴天》", "晴天", true},
+		{"shape of you", "Shape of You", true},
+		{"晴天 周杰伦", "晴天", true},
+		{"七里香", "稻香", false},
+		{"", "稻香", false},
+	}
+	for _, c := range cases {
+		if got := FuzzyMatch(c.got, c.expected); got != c.want {
+			t.Errorf("FuzzyMatch(%q, %q) = %v, want %v", c.got, c.expected, got, c.want)
+		}
+	}
+}
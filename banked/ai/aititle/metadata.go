@@ -0,0 +1,381 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package aititle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"bvtc/log"
+)
+
+// VersionFlags 版本标记
+type VersionFlags struct {
+	Cover        bool `json:"cover"`        // 翻唱
+	Live         bool `json:"live"`         // 现场
+	Remix        bool `json:"remix"`        // 混音
+	Instrumental bool `json:"instrumental"` // 伴奏、纯音乐
+}
+
+// FieldConfidence 各字段的置信度，取值 0-1
+type FieldConfidence struct {
+	Song           float64 `json:"song"`
+	OriginalArtist float64 `json:"originalArtist"`
+	Performer      float64 `json:"performer"`
+	Version        float64 `json:"version"`
+}
+
+// Metadata 结构化抽取结果，创建任务时可作为 metadataOverride 使用
+type Metadata struct {
+	Song           string          `json:"song"`                     // 歌名
+	OriginalArtist string          `json:"originalArtist,omitempty"` // 原唱
+	Performer      string          `json:"performer,omitempty"`      // 演唱者，翻唱时通常是 UP 主
+	Version        VersionFlags    `json:"version"`
+	Confidence     FieldConfidence `json:"confidence"`
+	Repaired       bool            `json:"repaired,omitempty"` // 模型输出不合法，经过修复
+}
+
+// MetadataSchema 结构化抽取要求模型遵循的 JSON Schema
+const MetadataSchema = `{
+  "type": "object",
+  "required": ["song"],
+  "properties": {
+    "song": {"type": "string", "description": "歌名，只保留最主要的一首"},
+    "originalArtist": {"type": "string", "description": "原唱歌手，未知时为空字符串"},
+    "performer": {"type": "string", "description": "视频中的演唱者，翻唱时通常是 UP 主"},
+    "version": {
+      "type": "object",
+      "properties": {
+        "cover": {"type": "boolean"},
+        "live": {"type": "boolean"},
+        "remix": {"type": "boolean"},
+        "instrumental": {"type": "boolean"}
+      }
+    },
+    "confidence": {
+      "type": "object",
+      "description": "各字段置信度，0 到 1",
+      "properties": {
+        "song": {"type": "number"},
+        "originalArtist": {"type": "number"},
+        "performer": {"type": "number"},
+        "version": {"type": "number"}
+      }
+    }
+  }
+}`
+
+// metadataSystemPrompt 覆盖默认的“只返回标题”系统提示词
+const metadataSystemPrompt = "You extract song metadata. Output ONLY one JSON object that matches the given JSON Schema. No markdown, no extra words."
+
+// 模型没有给出置信度时的默认值；输出经过修复时使用较低的值
+const (
+	defaultConfidence  = 0.5
+	repairedConfidence = 0.3
+)
+
+// DisplayTitle 带版本后缀的标题，如“晴天 (Live)”
+func (m Metadata) DisplayTitle() string {
+	var tags []string
+	if m.Version.Cover {
+		tags = append(tags, "Cover")
+	}
+	if m.Version.Live {
+		tags = append(tags, "Live")
+	}
+	if m.Version.Remix {
+		tags = append(tags, "Remix")
+	}
+	if m.Version.Instrumental {
+		tags = append(tags, "Instrumental")
+	}
+	if len(tags) == 0 {
+		return m.Song
+	}
+	return m.Song + " (" + strings.Join(tags, ", ") + ")"
+}
+
+// metadataCacheKey 结构化结果与纯文本标题分开缓存，结构化提示词为内置模板
+func metadataCacheKey(bvid string) string {
+	return "meta:" + PromptVersion + ":" + bvid
+}
+
+// ExtractMetadataWithRules 规则解析置信度足够时直接返回，否则调用大模型结构化抽取；
+// 第二个返回值为结果来源 rule 或 llm
+func (s *Service) ExtractMetadataWithRules(ctx context.Context, bvid string, title string, question string) (Metadata, string, error) {
+	rule := ParseTitle(title)
+	if rule.Song != "" && rule.Confidence >= s.cfg.RuleThreshold {
+		s.stats.rule()
+		return rule.Metadata(), MethodRule, nil
+	}
+	m, err := s.ExtractMetadata(ctx, bvid, question)
+	if err != nil {
+		if rule.Song != "" {
+			return rule.Metadata(), MethodRule, nil
+		}
+		return Metadata{}, "", err
+	}
+	return m, MethodLLM, nil
+}
+
+// ExtractMetadata 结构化抽取：歌名、原唱、演唱者和版本标记，结果按 bvid 缓存
+func (s *Service) ExtractMetadata(ctx context.Context, bvid string, question string) (Metadata, error) {
+	orig := strings.TrimSpace(question)
+	if orig == "" {
+		return Metadata{}, errors.New("empty original title")
+	}
+
+	key := metadataCacheKey(bvid)
+	if cached, ok := s.cache.Get(ctx, key); ok {
+		var m Metadata
+		if err := json.Unmarshal([]byte(cached), &m); err == nil {
+			s.stats.cache(true)
+			log.Logger.Info("AITitle metadata cache hit", log.String("bvid", bvid))
+			return m, nil
+		}
+	}
+	s.stats.cache(false)
+
+	prompt := s.buildMetadataPrompt(orig)
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	text, err := s.complete(ctx, metadataSystemPrompt, prompt)
+	s.stats.llm(time.Since(start), err)
+	if err != nil {
+		log.Logger.Warn("AITitle metadata provider error",
+			log.String("model", s.cfg.Model),
+			log.String("bvid", bvid),
+			log.String("error", err.Error()),
+			log.Float32("elapsedMs", float32(time.Since(start).Milliseconds())),
+		)
+		return Metadata{}, err
+	}
+
+	m, err := ParseMetadata(text, s.cfg.MaxTitleLength)
+	if err != nil {
+		log.Logger.Warn("AITitle metadata invalid",
+			log.String("bvid", bvid),
+			log.String("output", text),
+			log.String("error", err.Error()),
+		)
+		return Metadata{}, err
+	}
+	if b, err := json.Marshal(m); err == nil {
+		if err := s.cache.Set(ctx, key, string(b), s.cfg.CacheTTL); err != nil {
+			log.Logger.Warn("AITitle cache set fail", log.String("bvid", bvid), log.Any("err", err))
+		}
+	}
+	log.Logger.Info("AITitle metadata success",
+		log.String("bvid", bvid),
+		log.String("song", m.Song),
+		log.Any("repaired", m.Repaired),
+		log.Float32("elapsedMs", float32(time.Since(start).Milliseconds())),
+	)
+	return m, nil
+}
+
+// buildMetadataPrompt：结构化抽取提问模板
+func (s *Service) buildMetadataPrompt(question string) string {
+	return fmt.Sprintf(`下面给了一首歌曲视频的标题、简介和 UP 主，分析视频中的歌曲信息，按 JSON Schema 输出一个 JSON 对象
+JSON Schema：
+%s
+有以下限制：
+1.song 只返回最最最主要的一首歌名，不要带版本说明
+2.翻唱时 performer 一般是 UP 主，originalArtist 是原唱
+3.不确定的字段留空，并给出较低的置信度
+现在的输入：%s`, MetadataSchema, question)
+}
+
+var (
+	codeFenceRe     = regexp.MustCompile("(?s)^```[a-zA-Z]*\\s*(.*?)\\s*```$")
+	trailingCommaRe = regexp.MustCompile(`,\s*([}\]])`)
+	smartQuotes     = strings.NewReplacer("“", `"`, "”", `"`)
+)
+
+// ParseMetadata 解析并校验模型输出，常见的格式问题（代码块、多余文字、尾逗号、
+// 单引号、中文引号、字段别名、纯文本标题）会被修复，修复过的结果 Repaired 为 true
+func ParseMetadata(text string, maxTitleLength int) (Metadata, error) {
+	raw, repaired, err := decodeMetadataJSON(text)
+	if err != nil {
+		// 模型完全没有输出 JSON：单行文本当作歌名
+		line := strings.TrimSpace(text)
+		if line == "" || strings.ContainsAny(line, "{}\n") {
+			return Metadata{}, fmt.Errorf("invalid metadata output: %w", err)
+		}
+		raw = map[string]any{"song": line}
+		repaired = true
+	}
+
+	m := Metadata{
+		Song:           cleanField(firstString(raw, "song", "title", "name", "歌名")),
+		OriginalArtist: cleanField(firstString(raw, "originalArtist", "original_artist", "artist", "原唱")),
+		Performer:      cleanField(firstString(raw, "performer", "singer", "演唱者")),
+		Repaired:       repaired,
+	}
+	if m.Song == "" {
+		return Metadata{}, errors.New("invalid metadata output: song is empty")
+	}
+	if maxTitleLength > 0 && utf8.RuneCountInString(m.Song) > maxTitleLength {
+		return Metadata{}, fmt.Errorf("invalid metadata output: song longer than %d", maxTitleLength)
+	}
+	var flagsOK bool
+	m.Version, flagsOK = parseVersion(raw["version"])
+	if !flagsOK {
+		m.Repaired = true
+	}
+
+	conf := parseConfidence(raw["confidence"])
+	m.Confidence = FieldConfidence{
+		Song:           pickConfidence(conf, "song", m.Song != "", m.Repaired),
+		OriginalArtist: pickConfidence(conf, "originalArtist", m.OriginalArtist != "", m.Repaired),
+		Performer:      pickConfidence(conf, "performer", m.Performer != "", m.Repaired),
+		Version:        pickConfidence(conf, "version", true, m.Repaired),
+	}
+	return m, nil
+}
+
+// decodeMetadataJSON 解析 JSON 对象，直接解析失败时逐步修复后重试
+func decodeMetadataJSON(text string) (map[string]any, bool, error) {
+	s := strings.TrimSpace(text)
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(s), &raw); err == nil {
+		return raw, false, nil
+	}
+
+	if m := codeFenceRe.FindStringSubmatch(s); m != nil {
+		s = m[1]
+	}
+	// 去掉 JSON 前后的说明文字
+	startIdx, endIdx := strings.Index(s, "{"), strings.LastIndex(s, "}")
+	if startIdx < 0 || endIdx <= startIdx {
+		return nil, true, errors.New("no json object found")
+	}
+	s = s[startIdx : endIdx+1]
+	s = smartQuotes.Replace(s)
+	s = trailingCommaRe.ReplaceAllString(s, "$1")
+	if !strings.Contains(s, `"`) {
+		s = strings.ReplaceAll(s, "'", `"`)
+	}
+	if err := json.Unmarshal([]byte(s), &raw); err != nil {
+		return nil, true, err
+	}
+	return raw, true, nil
+}
+
+func firstString(raw map[string]any, keys ...string) string {
+	for _, k := range keys {
+		if v, ok := raw[k].(string); ok && strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// cleanField 去掉书名号、引号和首尾空白
+func cleanField(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.Trim(s, `"'《》「」“”`)
+	return strings.TrimSpace(s)
+}
+
+// parseVersion 解析版本标记，兼容对象、字符串数组和单个字符串；格式不符时第二个返回值为 false
+func parseVersion(v any) (VersionFlags, bool) {
+	var f VersionFlags
+	set := func(name string) {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "cover", "翻唱":
+			f.Cover = true
+		case "live", "现场":
+			f.Live = true
+		case "remix", "混音":
+			f.Remix = true
+		case "instrumental", "伴奏", "纯音乐":
+			f.Instrumental = true
+		}
+	}
+	switch x := v.(type) {
+	case nil:
+		return f, true
+	case map[string]any:
+		for k, val := range x {
+			if b, ok := val.(bool); ok && b {
+				set(k)
+			}
+		}
+		return f, true
+	case []any:
+		for _, item := range x {
+			if s, ok := item.(string); ok {
+				set(s)
+			}
+		}
+	case string:
+		for _, s := range strings.FieldsFunc(x, func(r rune) bool { return r == ',' || r == '，' || r == ' ' }) {
+			set(s)
+		}
+	}
+	return f, false
+}
+
+// parseConfidence 解析置信度，兼容按字段的对象和单个数值
+func parseConfidence(v any) map[string]float64 {
+	out := make(map[string]float64)
+	switch x := v.(type) {
+	case map[string]any:
+		for k, val := range x {
+			if n, ok := val.(float64); ok {
+				out[k] = n
+			}
+		}
+	case float64:
+		for _, k := range []string{"song", "originalArtist", "performer", "version"} {
+			out[k] = x
+		}
+	}
+	return out
+}
+
+// pickConfidence 取字段置信度并限制在 0-1，百分数会换算；字段为空时为 0
+func pickConfidence(conf map[string]float64, field string, present bool, repaired bool) float64 {
+	if !present {
+		return 0
+	}
+	c, ok := conf[field]
+	if !ok || math.IsNaN(c) {
+		if repaired {
+			return repairedConfidence
+		}
+		return defaultConfidence
+	}
+	if c > 1 && c <= 100 {
+		c /= 100
+	}
+	return math.Max(0, math.Min(1, c))
+}
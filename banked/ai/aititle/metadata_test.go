@@ -0,0 +1,79 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package aititle
+
+import "testing"
+
+func TestParseMetadata(t *testing.T) {
+	cases := []struct {
+		name     string
+		text     string
+		song     string
+		original string
+		cover    bool
+		repaired bool
+	}{
+		{
+			name:     "valid",
+			text:     `{"song":"晴天","originalArtist":"周杰伦","performer":"某UP","version":{"cover":true},"confidence":{"song":0.9}}`,
+			song:     "晴天",
+			original: "周杰伦",
+			cover:    true,
+		},
+		{
+			name:     "code fence and trailing comma",
+			text:     "好的：\n```json\n{\"song\": \"《稻香》\", \"version\": [\"live\"],}\n```",
+			song:     "稻香",
+			repaired: true,
+		},
+		{
+			name:     "single quotes",
+			text:     `{'song': '七里香', 'artist': '周杰伦'}`,
+			song:     "七里香",
+			original: "周杰伦",
+			repaired: true,
+		},
+		{
+			name:     "plain text",
+			text:     "夜曲",
+			song:     "夜曲",
+			repaired: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m, err := ParseMetadata(c.text, 200)
+			if err != nil {
+				t.Fatalf("parse failed: %v", err)
+			}
+			if m.Song != c.song || m.OriginalArtist != c.original || m.Version.Cover != c.cover || m.Repaired != c.repaired {
+				t.Fatalf("unexpected metadata %+v", m)
+			}
+			if m.Confidence.Song <= 0 || m.Confidence.Song > 1 {
+				t.Fatalf("unexpected song confidence %v", m.Confidence.Song)
+			}
+		})
+	}
+
+	if _, err := ParseMetadata(`{"song": ""}`, 200); err == nil {
+		t.Fatal("expected error for empty song")
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package aititle
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/viper"
+)
+
+// PromptExample few-shot 示例
+type PromptExample struct {
+	Input  string `mapstructure:"input"`
+	Output string `mapstructure:"output"`
+}
+
+// PromptTemplate 提示词模板，可从配置文件加载，修改后无需重新编译
+type PromptTemplate struct {
+	Version  string          `mapstructure:"version"`  // 版本号，参与缓存 key，修改模板时需要变更
+	System   string          `mapstructure:"system"`   // 系统提示词，为空时使用 Provider 的默认值
+	Template string          `mapstructure:"template"` // text/template 格式，{{.Input}} 为标题和简介
+	Examples []PromptExample `mapstructure:"examples"` // 按顺序放在提问前面
+
+	tmpl *template.Template
+}
+
+// defaultPromptTemplate 内置提示词
+const defaultPromptTemplate = `下面给了一首歌曲视频的标题和简介，根据这些内容，分析这个视频的歌名是什么
+有以下限制：
+1.返回它的歌名，并且只用返回最最最主要的一首
+2.只用你提取的结果，其他什么都不要
+现在的输入：{{.Input}}`
+
+// DefaultPrompt 内置提示词模板，未配置模板文件时使用
+func DefaultPrompt() *PromptTemplate {
+	p := &PromptTemplate{Version: PromptVersion, Template: defaultPromptTemplate}
+	if err := p.compile(); err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// LoadPrompt 从 yaml 或 json 文件加载提示词模板
+func LoadPrompt(path string) (*PromptTemplate, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("read prompt file: %w", err)
+	}
+	var p PromptTemplate
+	if err := v.Unmarshal(&p); err != nil {
+		return nil, fmt.Errorf("parse prompt file: %w", err)
+	}
+	if err := p.compile(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *PromptTemplate) compile() error {
+	p.Version = strings.TrimSpace(p.Version)
+	if p.Version == "" {
+		return errors.New("prompt version is empty")
+	}
+	if strings.TrimSpace(p.Template) == "" {
+		return errors.New("prompt template is empty")
+	}
+	tmpl, err := template.New(p.Version).Option("missingkey=error").Parse(p.Template)
+	if err != nil {
+		return fmt.Errorf("parse prompt template: %w", err)
+	}
+	p.tmpl = tmpl
+	return nil
+}
+
+// Render 生成提示词：few-shot 示例 + 模板
+func (p *PromptTemplate) Render(input string) (string, error) {
+	var b strings.Builder
+	if len(p.Examples) > 0 {
+		b.WriteString("示例：\n")
+		for _, e := range p.Examples {
+			fmt.Fprintf(&b, "输入：%s\n输出：%s\n\n", strings.TrimSpace(e.Input), strings.TrimSpace(e.Output))
+		}
+	}
+	if err := p.tmpl.Execute(&b, struct{ Input string }{Input: input}); err != nil {
+		return "", fmt.Errorf("render prompt: %w", err)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package aititle
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// 建议的来源
+const (
+	MethodRule = "rule" // 规则解析
+	MethodLLM  = "llm"  // 大模型
+)
+
+// DefaultRuleThreshold 规则解析置信度不低于该值时不再调用大模型
+const DefaultRuleThreshold = 0.8
+
+// RuleResult 规则解析结果
+type RuleResult struct {
+	Song       string       `json:"song"`
+	Artist     string       `json:"artist,omitempty"` // 分隔符后面或书名号前面的歌手，翻唱时一般是原唱
+	Version    VersionFlags `json:"version"`
+	Confidence float64      `json:"confidence"` // 0-1
+	Rule       string       `json:"rule"`       // 命中的规则，便于排查
+}
+
+// Metadata 转换为结构化抽取结果
+func (r RuleResult) Metadata() Metadata {
+	m := Metadata{
+		Song:    r.Song,
+		Version: r.Version,
+		Confidence: FieldConfidence{
+			Song:    r.Confidence,
+			Version: r.Confidence,
+		},
+	}
+	if r.Artist != "" {
+		m.OriginalArtist = r.Artist
+		m.Confidence.OriginalArtist = r.Confidence * 0.8
+	}
+	return m
+}
+
+var (
+	// 【翻唱】[4K]（Live）等括号标签
+	tagRe = regexp.MustCompile(`【[^】]*】|\[[^\]]*\]|〖[^〗]*〗|（[^）]*）|\([^)]*\)`)
+	// 《歌名》
+	bookTitleRe = regexp.MustCompile(`《([^》]+)》`)
+	// 「歌名」『歌名』
+	cornerQuoteRe = regexp.MustCompile(`[「『]([^」』]+)[」』]`)
+	// 歌名 - 原唱、歌名 / artist、歌名｜原唱
+	separatorRe = regexp.MustCompile(`\s+[-－—–/|｜]\s+|\s*[－—｜]\s*`)
+	// 标题末尾的版本说明，如“cover”“翻唱”“live版”
+	versionSuffixRe = regexp.MustCompile(`(?i)[\s\-_]*(cover|翻唱|翻自|live版?|现场版?|remix|伴奏|纯音乐|instrumental)\s*$`)
+)
+
+// 版本关键词，匹配时不区分大小写
+var versionKeywords = []struct {
+	words []string
+	set   func(*VersionFlags)
+}{
+	{[]string{"翻唱", "翻自", "cover"}, func(f *VersionFlags) { f.Cover = true }},
+	{[]string{"live", "现场", "演唱会"}, func(f *VersionFlags) { f.Live = true }},
+	{[]string{"remix", "混音"}, func(f *VersionFlags) { f.Remix = true }},
+	{[]string{"伴奏", "纯音乐", "instrumental", "off vocal"}, func(f *VersionFlags) { f.Instrumental = true }},
+}
+
+// ParseTitle 按常见的括号、书名号和分隔符约定解析视频标题，返回歌名和置信度。
+// 无法识别时 Confidence 较低，由调用方决定是否交给大模型。
+func ParseTitle(title string) RuleResult {
+	s := strings.TrimSpace(title)
+	var r RuleResult
+	if s == "" {
+		return r
+	}
+
+	// 书名号、直角引号内容明确，先于括号标签处理，避免歌名中的括号被当作标签
+	if m := bookTitleRe.FindStringSubmatchIndex(s); m != nil {
+		r.Song = cleanSong(s[m[2]:m[3]])
+		r.Artist = cleanArtist(tagRe.ReplaceAllString(s[:m[0]], ""))
+		r.Version = detectVersion(s)
+		r.Rule = "book-title"
+		r.Confidence = 0.95
+		return finish(r)
+	}
+	if m := cornerQuoteRe.FindStringSubmatchIndex(s); m != nil {
+		r.Song = cleanSong(s[m[2]:m[3]])
+		r.Artist = cleanArtist(tagRe.ReplaceAllString(s[:m[0]], ""))
+		r.Version = detectVersion(s)
+		r.Rule = "corner-quote"
+		r.Confidence = 0.9
+		return finish(r)
+	}
+
+	r.Version = detectVersion(s)
+	rest := strings.TrimSpace(tagRe.ReplaceAllString(s, " "))
+	rest = strings.TrimSpace(versionSuffixRe.ReplaceAllString(rest, ""))
+
+	parts := splitNonEmpty(separatorRe.Split(rest, -1))
+	switch {
+	case len(parts) == 2:
+		r.Song = cleanSong(parts[0])
+		r.Artist = cleanArtist(parts[1])
+		r.Rule = "separator"
+		r.Confidence = 0.85
+	case len(parts) > 2:
+		r.Song = cleanSong(parts[0])
+		r.Rule = "separator-multi"
+		r.Confidence = 0.5
+	case len(parts) == 1:
+		r.Song = cleanSong(parts[0])
+		r.Rule = "plain"
+		// 去掉标签后只剩很短的一段，多半就是歌名，但无法排除是其他描述
+		if utf8.RuneCountInString(r.Song) <= 12 && !strings.ContainsAny(r.Song, " ，,！!？?") {
+			r.Confidence = 0.6
+		} else {
+			r.Confidence = 0.2
+		}
+	}
+	return finish(r)
+}
+
+// finish 歌名为空或过长时降低置信度
+func finish(r RuleResult) RuleResult {
+	n := utf8.RuneCountInString(r.Song)
+	switch {
+	case n == 0:
+		r.Confidence = 0
+	case n > 30:
+		r.Confidence *= 0.5
+	}
+	return r
+}
+
+// detectVersion 根据整个标题中的关键词识别版本
+func detectVersion(s string) VersionFlags {
+	var f VersionFlags
+	lower := strings.ToLower(s)
+	for _, kw := range versionKeywords {
+		for _, w := range kw.words {
+			if strings.Contains(lower, w) {
+				kw.set(&f)
+				break
+			}
+		}
+	}
+	return f
+}
+
+func cleanSong(s string) string {
+	s = strings.TrimSpace(versionSuffixRe.ReplaceAllString(strings.TrimSpace(s), ""))
+	return cleanField(s)
+}
+
+// cleanArtist 歌手过长时多半是其他描述，直接丢弃
+func cleanArtist(s string) string {
+	s = strings.TrimSpace(versionSuffixRe.ReplaceAllString(strings.TrimSpace(s), ""))
+	s = strings.TrimSpace(strings.TrimRight(cleanField(s), "-－—:："))
+	if utf8.RuneCountInString(s) > 20 {
+		return ""
+	}
+	return s
+}
+
+func splitNonEmpty(parts []string) []string {
+	out := parts[:0]
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
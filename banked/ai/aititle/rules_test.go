@@ -0,0 +1,50 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package aititle
+
+import "testing"
+
+func TestParseTitle(t *testing.T) {
+	cases := []struct {
+		title   string
+		song    string
+		artist  string
+		cover   bool
+		live    bool
+		trusted bool // 置信度不低于默认阈值
+	}{
+		{title: "【翻唱】晴天 - 周杰伦", song: "晴天", artist: "周杰伦", cover: true, trusted: true},
+		{title: "周杰伦《七里香》现场版", song: "七里香", artist: "周杰伦", live: true, trusted: true},
+		{title: "「夜に駆ける」cover", song: "夜に駆ける", cover: true, trusted: true},
+		{title: "Lemon / 米津玄師", song: "Lemon", artist: "米津玄師", trusted: true},
+		{title: "【4K】稻香", song: "稻香"},
+		{title: "今天给大家唱一首很喜欢的歌，希望大家喜欢！", song: "今天给大家唱一首很喜欢的歌，希望大家喜欢！"},
+	}
+	for _, c := range cases {
+		r := ParseTitle(c.title)
+		if r.Song != c.song || r.Artist != c.artist || r.Version.Cover != c.cover || r.Version.Live != c.live {
+			t.Errorf("ParseTitle(%q) = %+v", c.title, r)
+		}
+		if trusted := r.Confidence >= DefaultRuleThreshold; trusted != c.trusted {
+			t.Errorf("ParseTitle(%q) confidence %v, want trusted=%v", c.title, r.Confidence, c.trusted)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package aititle
+
+import (
+	"sync"
+	"time"
+)
+
+// ServiceStats Service 的累计调用情况，通过 AI 状态接口暴露
+type ServiceStats struct {
+	CacheHits     int64      `json:"cacheHits"`
+	CacheMisses   int64      `json:"cacheMisses"`
+	CacheHitRate  float64    `json:"cacheHitRate"`
+	RuleHits      int64      `json:"ruleHits"` // 规则解析直接返回的次数
+	LLMCalls      int64      `json:"llmCalls"`
+	LLMErrors     int64      `json:"llmErrors"`
+	AvgLatencyMs  float64    `json:"avgLatencyMs"` // 成功调用大模型的平均耗时
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorAt   *time.Time `json:"lastErrorAt,omitempty"`
+	LastSuccessAt *time.Time `json:"lastSuccessAt,omitempty"`
+}
+
+type serviceStats struct {
+	mu           sync.Mutex
+	s            ServiceStats
+	totalLatency time.Duration
+}
+
+func (st *serviceStats) cache(hit bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if hit {
+		st.s.CacheHits++
+	} else {
+		st.s.CacheMisses++
+	}
+}
+
+func (st *serviceStats) rule() {
+	st.mu.Lock()
+	st.s.RuleHits++
+	st.mu.Unlock()
+}
+
+func (st *serviceStats) llm(latency time.Duration, err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.s.LLMCalls++
+	if err != nil {
+		st.s.LLMErrors++
+		st.s.LastError = err.Error()
+		now := time.Now()
+		st.s.LastErrorAt = &now
+		return
+	}
+	st.totalLatency += latency
+	now := time.Now()
+	st.s.LastSuccessAt = &now
+}
+
+// Stats 获取累计调用情况
+func (s *Service) Stats() ServiceStats {
+	st := &s.stats
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	out := st.s
+	if lookups := out.CacheHits + out.CacheMisses; lookups > 0 {
+		out.CacheHitRate = float64(out.CacheHits) / float64(lookups)
+	}
+	if ok := out.LLMCalls - out.LLMErrors; ok > 0 {
+		out.AvgLatencyMs = float64(st.totalLatency.Milliseconds()) / float64(ok)
+	}
+	return out
+}
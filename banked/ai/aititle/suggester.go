@@ -23,17 +23,16 @@ package aititle
 import (
 	"context"
 	"errors"
-	"fmt"
 	"strings"
-	"sync"
 	"time"
+	"unicode/utf8"
 
 	"bvtc/log"
 )
 
 // Suggester 为“标题建议器”的接口：
 type Suggester interface {
-	Suggest(ctx context.Context, originalTitle string) (suggestion string, err error)
+	Suggest(ctx context.Context, bvid string, question string) (suggestion string, err error)
 }
 
 // Provider 抽象“大模型提供方”，根据提示词返回纯文本。
@@ -41,65 +40,155 @@ type Provider interface {
 	CompleteText(ctx context.Context, prompt string) (string, error)
 }
 
+// SystemPromptProvider 支持按次指定系统提示词的 Provider，提示词模板和结构化抽取用它覆盖默认系统提示词
+type SystemPromptProvider interface {
+	CompleteTextWithSystem(ctx context.Context, system string, prompt string) (string, error)
+}
+
+// StreamingProvider 支持流式输出的 Provider，每收到一段内容用目前为止的完整输出调用一次 onPartial，
+// 返回完整文本；system 为空时使用 Provider 的默认系统提示词
+type StreamingProvider interface {
+	StreamText(ctx context.Context, system string, prompt string, onPartial func(text string)) (string, error)
+}
+
+// PartialFunc 流式生成过程中回调目前为止的完整输出（未清洗）
+type PartialFunc func(text string)
+
 // ServerConfig 服务配置项
 type ServerConfig struct {
 	Model          string
 	Timeout        time.Duration
 	CacheTTL       time.Duration
 	MaxTitleLength int
+	RuleThreshold  float64         // 规则解析置信度不低于该值时不调用大模型，0 时使用默认值
+	Prompt         *PromptTemplate // 提示词模板，为空时使用内置模板
 }
 
-// Service 实现 Suggester，提供：LLM 调用、超时控制、内存缓存。
+// Suggestion 标题建议及其来源
+type Suggestion struct {
+	Title      string  `json:"title"`
+	Method     string  `json:"method"` // rule 或 llm
+	Confidence float64 `json:"confidence,omitempty"`
+}
+
+// PromptVersion 内置提示词的版本，修改内置模板时需要递增，使旧缓存失效
+const PromptVersion = "v1"
+
+// Service 实现 Suggester，提供：LLM 调用、超时控制、缓存。
+// 进程内共享一个实例，缓存按 bvid 和提示词版本区分。
 type Service struct {
 	provider Provider
 	cfg      ServerConfig
-
-	mu    sync.Mutex
-	cache map[string]cachedItem
-}
-
-type cachedItem struct {
-	suggestion string
-	expireAt   time.Time
+	cache    Cache
+	stats    serviceStats
 }
 
-// NewService 初始化 Service。
-func NewService(p Provider, cfg ServerConfig) *Service {
+// NewService 初始化 Service，cache 为空时使用进程内 LRU 缓存。
+func NewService(p Provider, cfg ServerConfig, cache Cache) *Service {
 	cfg.MaxTitleLength = 200
+	if cfg.RuleThreshold <= 0 {
+		cfg.RuleThreshold = DefaultRuleThreshold
+	}
+	if cfg.Prompt == nil {
+		cfg.Prompt = DefaultPrompt()
+	}
+	if cache == nil {
+		cache = NewLRUCache(0)
+	}
 
 	return &Service{
 		provider: p,
 		cfg:      cfg,
-		cache:    make(map[string]cachedItem),
+		cache:    cache,
 	}
 }
 
+// cacheKey 缓存 key：提示词版本 + bvid
+func (s *Service) cacheKey(bvid string) string {
+	return s.cfg.Prompt.Version + ":" + bvid
+}
+
+// PromptVersion 当前使用的提示词版本
+func (s *Service) PromptVersion() string {
+	return s.cfg.Prompt.Version
+}
+
+// Invalidate 删除 bvid 的缓存（包括结构化结果），下次请求重新生成
+func (s *Service) Invalidate(ctx context.Context, bvid string) error {
+	if err := s.cache.Delete(ctx, s.cacheKey(bvid)); err != nil {
+		return err
+	}
+	return s.cache.Delete(ctx, metadataCacheKey(bvid))
+}
+
+// SuggestWithRules 先用规则解析原标题，置信度足够时直接返回，否则调用大模型；
+// 大模型失败时退回规则解析的结果
+func (s *Service) SuggestWithRules(ctx context.Context, bvid string, title string, question string) (Suggestion, error) {
+	return s.SuggestWithRulesStream(ctx, bvid, title, question, nil)
+}
+
+// SuggestWithRulesStream 同 SuggestWithRules，调用大模型时通过 onPartial 回调流式输出
+func (s *Service) SuggestWithRulesStream(ctx context.Context, bvid string, title string, question string, onPartial PartialFunc) (Suggestion, error) {
+	rule := ParseTitle(title)
+	if rule.Song != "" && rule.Confidence >= s.cfg.RuleThreshold {
+		log.Logger.Info("AITitle rule hit",
+			log.String("bvid", bvid),
+			log.String("rule", rule.Rule),
+			log.String("suggested", rule.Song),
+		)
+		s.stats.rule()
+		return Suggestion{Title: rule.Song, Method: MethodRule, Confidence: rule.Confidence}, nil
+	}
+
+	suggested, err := s.SuggestStream(ctx, bvid, question, onPartial)
+	if err != nil {
+		if rule.Song != "" {
+			return Suggestion{Title: rule.Song, Method: MethodRule, Confidence: rule.Confidence}, nil
+		}
+		return Suggestion{}, err
+	}
+	return Suggestion{Title: suggested, Method: MethodLLM}, nil
+}
+
 // 纯文本模式，不再依赖 JSON 结构化返回
 
 // Suggest：核心流程
 // 1) 预处理与缓存命中
 // 2) 构造提示词并调用 LLM（带超时）
 // 3) 读取模型文本输出
-// 4) 写入缓存并返回
-func (s *Service) Suggest(ctx context.Context, question string) (string, error) {
+// 4) 清洗、写入缓存并返回
+func (s *Service) Suggest(ctx context.Context, bvid string, question string) (string, error) {
+	return s.SuggestStream(ctx, bvid, question, nil)
+}
+
+// SuggestStream 同 Suggest，onPartial 不为空且 Provider 支持流式输出时逐段回调，
+// 缓存命中时不回调；最终结果仍经过清洗并写入缓存
+func (s *Service) SuggestStream(ctx context.Context, bvid string, question string, onPartial PartialFunc) (string, error) {
 	orig := strings.TrimSpace(question)
 	if orig == "" {
 		return "", errors.New("empty original title")
 	}
 
-	if suggested, ok := s.getCache(orig); ok {
+	key := s.cacheKey(bvid)
+	if suggested, ok := s.cache.Get(ctx, key); ok {
+		s.stats.cache(true)
 		log.Logger.Info("AITitle cache hit",
-			log.String("original", orig),
+			log.String("bvid", bvid),
 		)
 		return suggested, nil
 	}
+	s.stats.cache(false)
 
-	prompt := s.buildPrompt(orig)
+	prompt, err := s.cfg.Prompt.Render(orig)
+	if err != nil {
+		return "", err
+	}
 	ctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
 	defer cancel()
 
 	start := time.Now()
-	text, err := s.provider.CompleteText(ctx, prompt)
+	text, err := s.completeStream(ctx, s.cfg.Prompt.System, prompt, onPartial)
+	s.stats.llm(time.Since(start), err)
 	if err != nil {
 		log.Logger.Warn("AITitle provider error",
 			log.String("model", s.cfg.Model),
@@ -112,7 +201,7 @@ func (s *Service) Suggest(ctx context.Context, question string) (string, error)
 	}
 
 	// 输出结果
-	suggested := strings.TrimSpace(text)
+	suggested := sanitizeSuggestion(text, s.cfg.MaxTitleLength)
 
 	if suggested == "" {
 		log.Logger.Warn("AITitle low confidence or empty suggestion",
@@ -121,7 +210,9 @@ func (s *Service) Suggest(ctx context.Context, question string) (string, error)
 		)
 		return "", errors.New("empty suggestion from AI model")
 	}
-	s.setCache(orig, suggested)
+	if err := s.cache.Set(ctx, key, suggested, s.cfg.CacheTTL); err != nil {
+		log.Logger.Warn("AITitle cache set fail", log.String("bvid", bvid), log.Any("err", err))
+	}
 	log.Logger.Info("AITitle success",
 		log.String("original", orig),
 		log.String("suggested", suggested),
@@ -130,35 +221,38 @@ func (s *Service) Suggest(ctx context.Context, question string) (string, error)
 	return suggested, nil
 }
 
-// buildPrompt：提问模板
-func (s *Service) buildPrompt(question string) string {
-	return fmt.Sprintf(`下面给了一首歌曲视频的标题和简介，根据这些内容，分析这个视频的歌名是什么
-有以下限制：
-1.返回它的歌名，并且只用返回最最最主要的一首
-2.只用你提取的结果，其他什么都不要
-现在的输入：%s`, question)
+// completeStream onPartial 不为空且 Provider 支持时流式调用模型，否则退回 complete
+func (s *Service) completeStream(ctx context.Context, system string, prompt string, onPartial PartialFunc) (string, error) {
+	sp, ok := s.provider.(StreamingProvider)
+	if onPartial == nil || !ok {
+		return s.complete(ctx, system, prompt)
+	}
+	return sp.StreamText(ctx, system, prompt, onPartial)
 }
 
-// getCache：同一原标题在 TTL 内不重复请求 LLM。
-func (s *Service) getCache(key string) (string, bool) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	item, ok := s.cache[key]
-	if !ok || time.Now().After(item.expireAt) {
-		if ok {
-			delete(s.cache, key)
-		}
-		return "", false
+// complete 调用模型，system 非空且 Provider 支持时覆盖默认系统提示词
+func (s *Service) complete(ctx context.Context, system string, prompt string) (string, error) {
+	if sp, ok := s.provider.(SystemPromptProvider); ok && system != "" {
+		return sp.CompleteTextWithSystem(ctx, system, prompt)
 	}
-	return item.suggestion, true
+	return s.provider.CompleteText(ctx, prompt)
 }
 
-// setCache：写入简易内存缓存。
-func (s *Service) setCache(key, suggestion string) {
-	s.mu.Lock()
-	s.cache[key] = cachedItem{
-		suggestion: suggestion,
-		expireAt:   time.Now().Add(s.cfg.CacheTTL),
+// sanitizeSuggestion 清洗模型输出：取第一行非空内容，去掉“歌名：”等前缀、引号和书名号，超长时截断
+func sanitizeSuggestion(text string, maxLen int) string {
+	var line string
+	for _, l := range strings.Split(text, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			line = l
+			break
+		}
+	}
+	for _, prefix := range []string{"歌名：", "歌名:", "标题：", "标题:"} {
+		line = strings.TrimPrefix(line, prefix)
+	}
+	line = cleanField(line)
+	if maxLen > 0 && utf8.RuneCountInString(line) > maxLen {
+		line = string([]rune(line)[:maxLen])
 	}
-	s.mu.Unlock()
+	return line
 }
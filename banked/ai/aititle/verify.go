@@ -0,0 +1,108 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package aititle
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// VerifyThreshold 候选得分不低于该值时认为建议已在曲库中验证
+const VerifyThreshold = 0.75
+
+// 评分权重：歌名相似度、歌手提示、时长接近程度
+const (
+	nameWeight     = 0.6
+	artistWeight   = 0.15
+	durationWeight = 0.25
+)
+
+// Candidate 曲库搜索得到的候选歌曲
+type Candidate struct {
+	SongId   int64    `json:"songId"`
+	Name     string   `json:"name"`
+	Artists  []string `json:"artists"`
+	Duration int      `json:"duration"` // 秒
+	Score    float64  `json:"score"`    // 0-1
+}
+
+// Verification 验证结果
+type Verification struct {
+	Verified   bool        `json:"verified"`
+	Title      string      `json:"title,omitempty"` // 验证通过时为曲库中的歌名
+	Candidates []Candidate `json:"candidates"`
+}
+
+// RankCandidates 按歌名相似度、歌手提示（通常是 UP 主）和时长接近程度给候选打分，
+// 返回得分最高的 limit 个；videoDuration 为 0 时时长项取中间值
+func RankCandidates(suggested string, artistHint string, videoDuration time.Duration, cands []Candidate, limit int) Verification {
+	hint := normalizeTitle(artistHint)
+	ranked := make([]Candidate, 0, len(cands))
+	for _, c := range cands {
+		score := nameWeight * similarity(suggested, c.Name)
+		if hint != "" {
+			for _, a := range c.Artists {
+				if na := normalizeTitle(a); na != "" && (strings.Contains(hint, na) || strings.Contains(na, hint)) {
+					score += artistWeight
+					break
+				}
+			}
+		}
+		score += durationWeight * durationCloseness(videoDuration, time.Duration(c.Duration)*time.Second)
+		c.Score = math.Round(score*1000) / 1000
+		ranked = append(ranked, c)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Score > ranked[j].Score })
+	if limit > 0 && len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+
+	v := Verification{Candidates: ranked}
+	if len(ranked) > 0 && ranked[0].Score >= VerifyThreshold {
+		v.Verified = true
+		v.Title = ranked[0].Name
+	}
+	return v
+}
+
+// similarity 归一化后的编辑距离相似度，0-1
+func similarity(a, b string) float64 {
+	ra, rb := []rune(normalizeTitle(a)), []rune(normalizeTitle(b))
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 0
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// durationCloseness 时长越接近越高；视频通常比歌曲略长（片头、说话），差 10% 以内视为一致
+func durationCloseness(video, song time.Duration) float64 {
+	if video <= 0 || song <= 0 {
+		return 0.5
+	}
+	diff := math.Abs(float64(video-song)) / float64(max(video, song))
+	if diff <= 0.1 {
+		return 1
+	}
+	return math.Max(0, 1-diff)
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package aititle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRankCandidates(t *testing.T) {
+	cands := []Candidate{
+		{SongId: 1, Name: "晴天（Live）", Artists: []string{"周杰伦"}, Duration: 330},
+		{SongId: 2, Name: "晴天", Artists: []string{"周杰伦"}, Duration: 269},
+		{SongId: 3, Name: "晴天娃娃", Artists: []string{"某歌手"}, Duration: 200},
+	}
+	v := RankCandidates("晴天", "周杰伦", 275*time.Second, cands, 2)
+	if !v.Verified || v.Title != "晴天" || len(v.Candidates) != 2 || v.Candidates[0].SongId != 2 {
+		t.Fatalf("unexpected verification %+v", v)
+	}
+
+	v = RankCandidates("不存在的歌", "", 0, cands, 3)
+	if v.Verified {
+		t.Fatalf("unexpected verified result %+v", v)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ai
+
+import (
+	"fmt"
+	"os"
+
+	"bvtc/ai/aititle"
+	"bvtc/ai/providers"
+	"bvtc/config"
+	"bvtc/log"
+	redis_pool "bvtc/tool/pool"
+)
+
+var (
+	// 启动时根据配置创建的 Provider 链：主 Provider + 备用 Provider
+	provider *providers.Chain
+	// 进程内共享的标题建议服务，缓存跨请求保留
+	titleService *aititle.Service
+)
+
+// InitProvider 根据 Ai.provider 和 Ai.fallbacks 配置创建 Provider 链和共享的标题建议服务，
+// 未知名称或参数缺失时返回错误。Ai.cache_backend 为 redis 时需要在 Redis 初始化之后调用
+func InitProvider() error {
+	AiCfg := config.GetConfig().Ai
+	primary, err := providers.New(AiCfg.Provider, providers.Options{
+		BaseURL:      AiCfg.BaseURL,
+		Model:        AiCfg.Model,
+		APIKey:       AiCfg.APIKey,
+		Temperature:  AiCfg.Temperature,
+		SystemPrompt: AiCfg.SystemPrompt,
+		Timeout:      AiCfg.Timeout,
+	})
+	if err != nil {
+		return fmt.Errorf("init ai provider: %w", err)
+	}
+	members := []providers.ChainMember{{
+		Name:     memberName(AiCfg.Provider, AiCfg.Model),
+		Provider: primary,
+		Timeout:  AiCfg.Timeout,
+		Breaker:  providers.NewBreaker(AiCfg.Breaker.Failures, AiCfg.Breaker.Cooldown),
+	}}
+	for i, fb := range AiCfg.Fallbacks {
+		timeout := fb.Timeout
+		if timeout <= 0 {
+			timeout = AiCfg.Timeout
+		}
+		var apiKey string
+		if fb.APIKeyEnv != "" {
+			apiKey = os.Getenv(fb.APIKeyEnv)
+		}
+		p, err := providers.New(fb.Provider, providers.Options{
+			BaseURL:      fb.BaseURL,
+			Model:        fb.Model,
+			APIKey:       apiKey,
+			Temperature:  AiCfg.Temperature,
+			SystemPrompt: AiCfg.SystemPrompt,
+			Timeout:      timeout,
+		})
+		if err != nil {
+			return fmt.Errorf("init ai fallback provider %d: %w", i, err)
+		}
+		members = append(members, providers.ChainMember{
+			Name:     memberName(fb.Provider, fb.Model),
+			Provider: p,
+			Timeout:  timeout,
+			Breaker:  providers.NewBreaker(AiCfg.Breaker.Failures, AiCfg.Breaker.Cooldown),
+		})
+	}
+	chain := providers.NewChain(members...)
+	provider = chain
+	initSlots(AiCfg.Concurrency)
+
+	var cache aititle.Cache
+	switch AiCfg.CacheBackend {
+	case "", "memory":
+		cache = aititle.NewLRUCache(AiCfg.CacheSize)
+	case "redis":
+		cache = aititle.NewRedisCache(redis_pool.GetRdb(), "ai:title:")
+	default:
+		return fmt.Errorf("unknown ai cache backend %q", AiCfg.CacheBackend)
+	}
+	prompt := aititle.DefaultPrompt()
+	if AiCfg.PromptFile != "" {
+		if prompt, err = aititle.LoadPrompt(AiCfg.PromptFile); err != nil {
+			return fmt.Errorf("load ai prompt: %w", err)
+		}
+	}
+	// 整体超时覆盖整条链，单个 Provider 的超时由链控制
+	timeout := AiCfg.Timeout
+	if total := chain.TotalTimeout(); total > timeout {
+		timeout = total
+	}
+	titleService = aititle.NewService(chain, aititle.ServerConfig{
+		Model:          AiCfg.Model,
+		Timeout:        timeout,
+		CacheTTL:       AiCfg.CacheTTL,
+		MaxTitleLength: AiCfg.MaxTitleLength,
+		RuleThreshold:  AiCfg.RuleThreshold,
+		Prompt:         prompt,
+	}, cache)
+
+	log.Logger.Info("AI provider selected",
+		log.String("provider", AiCfg.Provider),
+		log.String("baseURL", AiCfg.BaseURL),
+		log.String("model", AiCfg.Model),
+		log.Int("fallbacks", len(AiCfg.Fallbacks)),
+		log.String("cacheBackend", AiCfg.CacheBackend),
+		log.String("promptVersion", prompt.Version),
+	)
+	return nil
+}
+
+// currentTitleService 获取共享的标题建议服务
+func currentTitleService() (*aititle.Service, error) {
+	if titleService == nil {
+		return nil, fmt.Errorf("ai title service is not initialized")
+	}
+	return titleService, nil
+}
+
+// memberName Provider 链上的名称，用于日志和健康检查
+func memberName(name string, model string) string {
+	if name == "" {
+		name = "ollama"
+	}
+	if model == "" {
+		return name
+	}
+	return name + ":" + model
+}
+
+// ProviderStatus 各 Provider 的熔断状态，未初始化时为空
+func ProviderStatus() []providers.MemberStatus {
+	if provider == nil {
+		return nil
+	}
+	return provider.Status()
+}
+
+// currentProvider 获取启动时选定的 Provider
+func currentProvider() (aititle.Provider, error) {
+	if provider == nil {
+		return nil, fmt.Errorf("ai provider is not initialized")
+	}
+	return provider, nil
+}
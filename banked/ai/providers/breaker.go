@@ -0,0 +1,146 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package providers
+
+import (
+	"sync"
+	"time"
+)
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"    // 正常调用
+	BreakerOpen     = "open"      // 连续失败，暂停调用
+	BreakerHalfOpen = "half-open" // 冷却结束，放行一次探测请求
+)
+
+// 熔断器默认参数
+const (
+	DefaultBreakerFailures = 3
+	DefaultBreakerCooldown = 30 * time.Second
+)
+
+// Breaker 熔断器：连续失败达到阈值后打开，冷却时间过后进入半开状态，
+// 只放行一次探测请求，成功则关闭，失败则重新打开
+type Breaker struct {
+	failures int
+	cooldown time.Duration
+
+	mu          sync.Mutex
+	state       string
+	consecutive int
+	openedAt    time.Time
+	probing     bool
+	lastError   string
+	lastFailure time.Time
+}
+
+// BreakerStatus 熔断器状态快照，通过健康检查接口暴露
+type BreakerStatus struct {
+	State               string    `json:"state"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	OpenedAt            time.Time `json:"openedAt,omitempty"`
+	LastError           string    `json:"lastError,omitempty"`
+	LastFailureAt       time.Time `json:"lastFailureAt,omitempty"`
+}
+
+// NewBreaker 创建熔断器，参数不大于 0 时使用默认值
+func NewBreaker(failures int, cooldown time.Duration) *Breaker {
+	if failures <= 0 {
+		failures = DefaultBreakerFailures
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultBreakerCooldown
+	}
+	return &Breaker{failures: failures, cooldown: cooldown, state: BreakerClosed}
+}
+
+// Allow 是否允许本次调用；半开状态下只有第一个调用者获得探测机会
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Success 记录调用成功，关闭熔断器
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = BreakerClosed
+	b.consecutive = 0
+	b.probing = false
+}
+
+// Failure 记录调用失败，连续失败达到阈值或探测失败时打开熔断器
+func (b *Breaker) Failure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.consecutive++
+	b.lastFailure = time.Now()
+	if err != nil {
+		b.lastError = err.Error()
+	}
+	if b.state == BreakerHalfOpen || b.consecutive >= b.failures {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+	b.probing = false
+}
+
+// Release 调用被取消（不代表 Provider 故障）时归还半开状态的探测机会
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// Status 获取状态快照
+func (b *Breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state := b.state
+	if state == BreakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		state = BreakerHalfOpen
+	}
+	return BreakerStatus{
+		State:               state,
+		ConsecutiveFailures: b.consecutive,
+		OpenedAt:            b.openedAt,
+		LastError:           b.lastError,
+		LastFailureAt:       b.lastFailure,
+	}
+}
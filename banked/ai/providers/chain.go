@@ -0,0 +1,169 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"bvtc/ai/aititle"
+	"bvtc/log"
+)
+
+// ErrAllProvidersFailed 链上所有 Provider 都失败或已熔断
+var ErrAllProvidersFailed = errors.New("all ai providers failed")
+
+// ChainMember 链上的一个 Provider
+type ChainMember struct {
+	Name     string
+	Provider aititle.Provider
+	Timeout  time.Duration // 单次调用超时，0 时只受调用方 ctx 限制
+	Breaker  *Breaker
+}
+
+// MemberStatus 链上 Provider 的状态
+type MemberStatus struct {
+	Name    string        `json:"name"`
+	Timeout string        `json:"timeout"`
+	Breaker BreakerStatus `json:"breaker"`
+}
+
+// Chain 按顺序尝试多个 Provider：熔断中的直接跳过，失败时换下一个。
+// 全部失败时返回 ErrAllProvidersFailed，由调用方退回规则解析
+type Chain struct {
+	members []ChainMember
+}
+
+// NewChain 创建 Provider 链，Breaker 为空的成员使用默认参数
+func NewChain(members ...ChainMember) *Chain {
+	for i := range members {
+		if members[i].Breaker == nil {
+			members[i].Breaker = NewBreaker(0, 0)
+		}
+	}
+	return &Chain{members: members}
+}
+
+// Members 链上的 Provider，按尝试顺序
+func (c *Chain) Members() []ChainMember {
+	return c.members
+}
+
+// Status 各 Provider 的熔断状态
+func (c *Chain) Status() []MemberStatus {
+	out := make([]MemberStatus, 0, len(c.members))
+	for _, m := range c.members {
+		out = append(out, MemberStatus{Name: m.Name, Timeout: m.Timeout.String(), Breaker: m.Breaker.Status()})
+	}
+	return out
+}
+
+// TotalTimeout 所有成员超时之和，调用方的整体超时不应小于该值
+func (c *Chain) TotalTimeout() time.Duration {
+	var total time.Duration
+	for _, m := range c.members {
+		total += m.Timeout
+	}
+	return total
+}
+
+// CompleteText 使用各 Provider 的默认系统提示词
+func (c *Chain) CompleteText(ctx context.Context, prompt string) (string, error) {
+	return c.run(ctx, func(ctx context.Context, p aititle.Provider) (string, error) {
+		return p.CompleteText(ctx, prompt)
+	})
+}
+
+// CompleteTextWithSystem 成员不支持指定系统提示词时使用其默认值
+func (c *Chain) CompleteTextWithSystem(ctx context.Context, system string, prompt string) (string, error) {
+	return c.run(ctx, func(ctx context.Context, p aititle.Provider) (string, error) {
+		if sp, ok := p.(aititle.SystemPromptProvider); ok && system != "" {
+			return sp.CompleteTextWithSystem(ctx, system, prompt)
+		}
+		return p.CompleteText(ctx, prompt)
+	})
+}
+
+// StreamText 成员不支持流式输出时一次性回调完整结果；换到下一个成员时 onPartial 从头开始
+func (c *Chain) StreamText(ctx context.Context, system string, prompt string, onPartial func(text string)) (string, error) {
+	return c.run(ctx, func(ctx context.Context, p aititle.Provider) (string, error) {
+		if sp, ok := p.(aititle.StreamingProvider); ok {
+			return sp.StreamText(ctx, system, prompt, onPartial)
+		}
+		var text string
+		var err error
+		if sp, ok := p.(aititle.SystemPromptProvider); ok && system != "" {
+			text, err = sp.CompleteTextWithSystem(ctx, system, prompt)
+		} else {
+			text, err = p.CompleteText(ctx, prompt)
+		}
+		if err == nil && onPartial != nil {
+			onPartial(text)
+		}
+		return text, err
+	})
+}
+
+func (c *Chain) run(ctx context.Context, call func(ctx context.Context, p aititle.Provider) (string, error)) (string, error) {
+	var lastErr error
+	for _, m := range c.members {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if !m.Breaker.Allow() {
+			continue
+		}
+
+		callCtx, cancel := ctx, context.CancelFunc(func() {})
+		if m.Timeout > 0 {
+			callCtx, cancel = context.WithTimeout(ctx, m.Timeout)
+		}
+		text, err := call(callCtx, m.Provider)
+		cancel()
+		if err == nil && strings.TrimSpace(text) == "" {
+			// 空输出同样换下一个 Provider
+			err = errors.New("empty response")
+		}
+		if err == nil {
+			m.Breaker.Success()
+			return text, nil
+		}
+		if ctx.Err() != nil {
+			// 调用方取消，不算 Provider 故障
+			m.Breaker.Release()
+			return "", ctx.Err()
+		}
+		m.Breaker.Failure(err)
+		lastErr = err
+		log.Logger.Warn("AI provider failed, try next",
+			log.String("provider", m.Name),
+			log.String("breaker", m.Breaker.Status().State),
+			log.String("error", err.Error()),
+		)
+	}
+	if lastErr == nil {
+		return "", fmt.Errorf("%w: all circuit breakers open", ErrAllProvidersFailed)
+	}
+	return "", fmt.Errorf("%w: %v", ErrAllProvidersFailed, lastErr)
+}
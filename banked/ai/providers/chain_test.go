@@ -0,0 +1,76 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package providers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"bvtc/log"
+
+	"go.uber.org/zap"
+)
+
+type failingProvider struct{ calls int }
+
+func (p *failingProvider) CompleteText(ctx context.Context, prompt string) (string, error) {
+	p.calls++
+	return "", errors.New("connection refused")
+}
+
+func TestChainFallbackAndBreaker(t *testing.T) {
+	log.Logger = zap.NewNop()
+	primary := &failingProvider{}
+	breaker := NewBreaker(2, 50*time.Millisecond)
+	chain := NewChain(
+		ChainMember{Name: "primary", Provider: primary, Timeout: time.Second, Breaker: breaker},
+		ChainMember{Name: "stub", Provider: &StubProvider{Reply: "晴天"}},
+	)
+
+	for i := 0; i < 3; i++ {
+		got, err := chain.CompleteText(context.Background(), "标题：晴天")
+		if err != nil || got != "晴天" {
+			t.Fatalf("call %d: unexpected result %q, err %v", i, got, err)
+		}
+	}
+	// 连续失败两次后熔断，第三次不再调用主 Provider
+	if primary.calls != 2 || breaker.Status().State != BreakerOpen {
+		t.Fatalf("unexpected calls %d, state %s", primary.calls, breaker.Status().State)
+	}
+
+	// 冷却后半开，只放行一次探测
+	time.Sleep(60 * time.Millisecond)
+	if !breaker.Allow() || breaker.Allow() {
+		t.Fatal("half-open breaker should allow exactly one probe")
+	}
+	breaker.Success()
+	if breaker.Status().State != BreakerClosed {
+		t.Fatalf("unexpected state after probe success: %s", breaker.Status().State)
+	}
+
+	// 所有 Provider 都失败
+	only := NewChain(ChainMember{Name: "primary", Provider: &failingProvider{}})
+	if _, err := only.CompleteText(context.Background(), "x"); !errors.Is(err, ErrAllProvidersFailed) {
+		t.Fatalf("expected ErrAllProvidersFailed, got %v", err)
+	}
+}
@@ -24,16 +24,22 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
+
+	"bvtc/ai/aititle"
 )
 
 type OllamaProvider struct {
-	HTTPClient *http.Client
-	BaseURL    string
-	Model      string
+	HTTPClient   *http.Client
+	BaseURL      string
+	Model        string
+	Temperature  float64
+	SystemPrompt string
 }
 
 // NewOllamaProvider 初始化 Ollama 服务
@@ -43,10 +49,22 @@ func NewOllamaProvider(baseURL, model string, timeout time.Duration) *OllamaProv
 		panic("Ollama baseURL is empty")
 	}
 	return &OllamaProvider{
-		HTTPClient: &http.Client{Timeout: timeout},
-		BaseURL:    baseURL,
-		Model:      model,
+		HTTPClient:   &http.Client{Timeout: timeout},
+		BaseURL:      baseURL,
+		Model:        model,
+		Temperature:  DefaultTemperature,
+		SystemPrompt: DefaultSystemPrompt,
+	}
+}
+
+func newOllama(opts Options) (aititle.Provider, error) {
+	if opts.BaseURL == "" {
+		return nil, errors.New("ollama baseURL is empty")
 	}
+	p := NewOllamaProvider(opts.BaseURL, opts.Model, opts.Timeout)
+	p.Temperature = opts.Temperature
+	p.SystemPrompt = opts.SystemPrompt
+	return p, nil
 }
 
 type ollamaChatRequest struct {
@@ -66,42 +84,146 @@ type ollamaChatResponse struct {
 		Role    string `json:"role"`
 		Content string `json:"content"`
 	} `json:"message"`
+	Done  bool   `json:"done"`
+	Error string `json:"error,omitempty"`
 }
 
 // CompleteText 通过 Ollama Chat API 请求模型仅返回文本
 func (p *OllamaProvider) CompleteText(ctx context.Context, prompt string) (string, error) {
+	return p.CompleteTextWithSystem(ctx, p.SystemPrompt, prompt)
+}
+
+// CompleteTextWithSystem 使用指定的系统提示词请求模型
+func (p *OllamaProvider) CompleteTextWithSystem(ctx context.Context, system string, prompt string) (string, error) {
+	resp, err := p.chat(ctx, system, prompt, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var cr ollamaChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&cr); err != nil {
+		return "", err
+	}
+	content := cr.Message.Content
+	return content, nil
+}
+
+// StreamText 流式请求，Ollama 按行返回 NDJSON，每收到一段内容用累计输出调用一次 onPartial
+func (p *OllamaProvider) StreamText(ctx context.Context, system string, prompt string, onPartial func(text string)) (string, error) {
+	if system == "" {
+		system = p.SystemPrompt
+	}
+	resp, err := p.chat(ctx, system, prompt, true)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var full strings.Builder
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var cr ollamaChatResponse
+		if err := dec.Decode(&cr); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return full.String(), err
+		}
+		if cr.Error != "" {
+			return full.String(), fmt.Errorf("ollama stream: %s", cr.Error)
+		}
+		if delta := cr.Message.Content; delta != "" {
+			full.WriteString(delta)
+			if onPartial != nil {
+				onPartial(full.String())
+			}
+		}
+		if cr.Done {
+			break
+		}
+	}
+	return full.String(), nil
+}
+
+// chat 发送 Chat API 请求，状态码不是 200 时返回错误
+func (p *OllamaProvider) chat(ctx context.Context, system string, prompt string, stream bool) (*http.Response, error) {
 	reqBody := ollamaChatRequest{
 		Model: p.Model,
 		Messages: []ollamaMessage{
-			{Role: "system", Content: "You output ONLY the song title text. No extra words, no quotes."},
+			{Role: "system", Content: system},
 			{Role: "user", Content: prompt},
 		},
-		Stream:  false,
-		Options: map[string]any{"temperature": 0.2},
+		Stream:  stream,
+		Options: map[string]any{"temperature": p.Temperature},
 	}
 	b, _ := json.Marshal(reqBody)
 	url := fmt.Sprintf("%s/api/chat", p.BaseURL)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := p.HTTPClient.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("ollama http %d: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("ollama http %d: %s", resp.StatusCode, string(body))
 	}
+	return resp, nil
+}
 
-	var cr ollamaChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&cr); err != nil {
-		return "", err
+type ollamaTagsResponse struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
+
+// ListModels 通过 /api/tags 获取本地已拉取的模型
+func (p *OllamaProvider) ListModels(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/api/tags", p.BaseURL), nil)
+	if err != nil {
+		return nil, err
 	}
-	content := cr.Message.Content
-	return content, nil
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("ollama http %d: %s", resp.StatusCode, string(body))
+	}
+	var tr ollamaTagsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(tr.Models))
+	for _, m := range tr.Models {
+		names = append(names, m.Name)
+	}
+	return names, nil
+}
+
+// HasModel 配置的模型是否已拉取；未指定 tag 时按 latest 匹配
+func (p *OllamaProvider) HasModel(ctx context.Context) (bool, []string, error) {
+	names, err := p.ListModels(ctx)
+	if err != nil {
+		return false, nil, err
+	}
+	want := p.Model
+	if !strings.Contains(want, ":") {
+		want += ":latest"
+	}
+	for _, n := range names {
+		if n == p.Model || n == want {
+			return true, names, nil
+		}
+	}
+	return false, names, nil
 }
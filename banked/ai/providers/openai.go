@@ -0,0 +1,195 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"bvtc/ai/aititle"
+)
+
+// OpenAIProvider 兼容 OpenAI /v1/chat/completions 的服务，如 vLLM、LM Studio、llama.cpp server
+type OpenAIProvider struct {
+	HTTPClient   *http.Client
+	BaseURL      string
+	Model        string
+	APIKey       string
+	Temperature  float64
+	SystemPrompt string
+}
+
+// NewOpenAIProvider 初始化 OpenAI 兼容服务，baseURL 可以带或不带 /v1
+func NewOpenAIProvider(baseURL, model string, timeout time.Duration) *OpenAIProvider {
+	return &OpenAIProvider{
+		HTTPClient:   &http.Client{Timeout: timeout},
+		BaseURL:      strings.TrimRight(baseURL, "/"),
+		Model:        model,
+		Temperature:  DefaultTemperature,
+		SystemPrompt: DefaultSystemPrompt,
+	}
+}
+
+func newOpenAI(opts Options) (aititle.Provider, error) {
+	if opts.BaseURL == "" {
+		return nil, errors.New("openai baseURL is empty")
+	}
+	p := NewOpenAIProvider(opts.BaseURL, opts.Model, opts.Timeout)
+	p.APIKey = opts.APIKey
+	p.Temperature = opts.Temperature
+	p.SystemPrompt = opts.SystemPrompt
+	return p, nil
+}
+
+type openAIChatRequest struct {
+	Model       string          `json:"model"`
+	Messages    []openAIMessage `json:"messages"`
+	Temperature float64         `json:"temperature"`
+	Stream      bool            `json:"stream"`
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message openAIMessage `json:"message"`
+	} `json:"choices"`
+}
+
+type openAIStreamChunk struct {
+	Choices []struct {
+		Delta openAIMessage `json:"delta"`
+	} `json:"choices"`
+}
+
+// CompleteText 通过 Chat Completions API 请求模型仅返回文本
+func (p *OpenAIProvider) CompleteText(ctx context.Context, prompt string) (string, error) {
+	return p.CompleteTextWithSystem(ctx, p.SystemPrompt, prompt)
+}
+
+// CompleteTextWithSystem 使用指定的系统提示词请求模型
+func (p *OpenAIProvider) CompleteTextWithSystem(ctx context.Context, system string, prompt string) (string, error) {
+	resp, err := p.chat(ctx, system, prompt, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var cr openAIChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&cr); err != nil {
+		return "", err
+	}
+	if len(cr.Choices) == 0 {
+		return "", errors.New("openai response has no choices")
+	}
+	return cr.Choices[0].Message.Content, nil
+}
+
+// StreamText 流式请求，服务端以 SSE 返回增量内容，以 data: [DONE] 结束
+func (p *OpenAIProvider) StreamText(ctx context.Context, system string, prompt string, onPartial func(text string)) (string, error) {
+	if system == "" {
+		system = p.SystemPrompt
+	}
+	resp, err := p.chat(ctx, system, prompt, true)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var full strings.Builder
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+		var chunk openAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return full.String(), err
+		}
+		for _, c := range chunk.Choices {
+			if c.Delta.Content == "" {
+				continue
+			}
+			full.WriteString(c.Delta.Content)
+			if onPartial != nil {
+				onPartial(full.String())
+			}
+		}
+	}
+	return full.String(), sc.Err()
+}
+
+// chat 发送 Chat Completions 请求，状态码不是 200 时返回错误
+func (p *OpenAIProvider) chat(ctx context.Context, system string, prompt string, stream bool) (*http.Response, error) {
+	reqBody := openAIChatRequest{
+		Model: p.Model,
+		Messages: []openAIMessage{
+			{Role: "system", Content: system},
+			{Role: "user", Content: prompt},
+		},
+		Temperature: p.Temperature,
+		Stream:      stream,
+	}
+	b, _ := json.Marshal(reqBody)
+
+	url := p.BaseURL
+	if !strings.HasSuffix(url, "/v1") {
+		url += "/v1"
+	}
+	url += "/chat/completions"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	}
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("openai http %d: %s", resp.StatusCode, string(body))
+	}
+	return resp, nil
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"bvtc/ai/aititle"
+)
+
+func TestOpenAIProviderCompleteText(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer sk-test" {
+			t.Errorf("unexpected authorization %q", got)
+		}
+		var req openAIChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode request failed: %v", err)
+		}
+		if req.Model != "qwen" || len(req.Messages) != 2 || req.Messages[0].Content != "sys" || req.Temperature != 0.5 {
+			t.Errorf("unexpected request %+v", req)
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"晴天"}}]}`))
+	}))
+	defer srv.Close()
+
+	p, err := New("OpenAI", Options{
+		BaseURL:      srv.URL + "/v1/",
+		Model:        "qwen",
+		APIKey:       "sk-test",
+		Temperature:  0.5,
+		SystemPrompt: "sys",
+		Timeout:      5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new provider failed: %v", err)
+	}
+	got, err := p.CompleteText(context.Background(), "标题：周杰伦 晴天")
+	if err != nil {
+		t.Fatalf("complete text failed: %v", err)
+	}
+	if got != "晴天" {
+		t.Fatalf("unexpected result %q", got)
+	}
+}
+
+func TestNewUnknownProvider(t *testing.T) {
+	if _, err := New("nope", Options{}); err == nil {
+		t.Fatal("expected error for unknown provider")
+	}
+}
+
+func TestStubProvider(t *testing.T) {
+	p, err := New("stub", Options{})
+	if err != nil {
+		t.Fatalf("new provider failed: %v", err)
+	}
+	got, err := p.CompleteText(context.Background(), "说明\n标题：稻香\n简介：xxx")
+	if err != nil || got != "稻香" {
+		t.Fatalf("unexpected result %q, err %v", got, err)
+	}
+}
+
+func TestStreamText(t *testing.T) {
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaChatRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream || req.Messages[0].Content != "sys" {
+			t.Errorf("unexpected request %+v", req)
+		}
+		_, _ = w.Write([]byte(`{"message":{"content":"晴"},"done":false}` + "\n" +
+			`{"message":{"content":"天"},"done":false}` + "\n" +
+			`{"message":{"content":""},"done":true}` + "\n"))
+	}))
+	defer ollama.Close()
+
+	openai := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("data: {\"choices\":[{\"delta\":{\"role\":\"assistant\"}}]}\n\n" +
+			"data: {\"choices\":[{\"delta\":{\"content\":\"晴\"}}]}\n\n" +
+			"data: {\"choices\":[{\"delta\":{\"content\":\"天\"}}]}\n\n" +
+			"data: [DONE]\n\n"))
+	}))
+	defer openai.Close()
+
+	for name, url := range map[string]string{"ollama": ollama.URL, "openai": openai.URL} {
+		p, err := New(name, Options{BaseURL: url, SystemPrompt: "sys", Timeout: 5 * time.Second})
+		if err != nil {
+			t.Fatalf("new %s provider failed: %v", name, err)
+		}
+		var partials []string
+		got, err := p.(aititle.StreamingProvider).StreamText(context.Background(), "", "标题：晴天", func(text string) {
+			partials = append(partials, text)
+		})
+		if err != nil || got != "晴天" || len(partials) != 2 || partials[0] != "晴" {
+			t.Fatalf("%s: unexpected result %q, partials %v, err %v", name, got, partials, err)
+		}
+	}
+}
+
+func TestOllamaHasModel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/tags" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		_, _ = w.Write([]byte(`{"models":[{"name":"qwen2.5:7b"},{"name":"llama3:latest"}]}`))
+	}))
+	defer srv.Close()
+
+	for model, want := range map[string]bool{"qwen2.5:7b": true, "llama3": true, "qwen2.5": false} {
+		p := NewOllamaProvider(srv.URL, model, 5*time.Second)
+		has, names, err := p.HasModel(context.Background())
+		if err != nil || has != want || len(names) != 2 {
+			t.Fatalf("%s: unexpected result %v, names %v, err %v", model, has, names, err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package providers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"bvtc/ai/aititle"
+)
+
+// 默认的系统提示词和采样温度，配置中未设置时使用
+const (
+	DefaultSystemPrompt = "You output ONLY the song title text. No extra words, no quotes."
+	DefaultTemperature  = 0.2
+)
+
+// Options 创建 Provider 的通用参数，不同 Provider 只使用其中需要的部分
+type Options struct {
+	BaseURL      string
+	Model        string
+	APIKey       string
+	Temperature  float64
+	SystemPrompt string
+	Timeout      time.Duration
+}
+
+// Factory 根据配置创建 Provider
+type Factory func(opts Options) (aititle.Provider, error)
+
+var (
+	mu        sync.RWMutex
+	factories = make(map[string]Factory)
+)
+
+func init() {
+	Register("ollama", newOllama)
+	Register("openai", newOpenAI)
+	Register("stub", newStub)
+}
+
+// Register 注册 Provider，名称不区分大小写，重复注册会覆盖
+func Register(name string, f Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	factories[strings.ToLower(name)] = f
+}
+
+// New 按名称创建 Provider，名称为空时使用 ollama
+func New(name string, opts Options) (aititle.Provider, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = "ollama"
+	}
+	mu.RLock()
+	f, ok := factories[name]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown ai provider %q, available: %s", name, strings.Join(Names(), ", "))
+	}
+	if opts.SystemPrompt == "" {
+		opts.SystemPrompt = DefaultSystemPrompt
+	}
+	return f(opts)
+}
+
+// Names 已注册的 Provider 名称
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
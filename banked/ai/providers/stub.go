@@ -0,0 +1,71 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package providers
+
+import (
+	"context"
+	"strings"
+
+	"bvtc/ai/aititle"
+)
+
+// StubProvider 不访问网络的确定性 Provider，用于测试和本地调试。
+// Reply 非空时总是返回 Reply，否则返回提示词中最后一个“标题：”所在行的内容
+type StubProvider struct {
+	Reply string
+}
+
+func newStub(opts Options) (aititle.Provider, error) {
+	return &StubProvider{}, nil
+}
+
+// CompleteText 返回固定的结果
+func (p *StubProvider) CompleteText(ctx context.Context, prompt string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if p.Reply != "" {
+		return p.Reply, nil
+	}
+	// 取最后一个“标题：”，few-shot 示例在提问前面
+	lines := strings.Split(prompt, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if _, title, ok := strings.Cut(lines[i], "标题："); ok {
+			return strings.TrimSpace(title), nil
+		}
+	}
+	return strings.TrimSpace(prompt), nil
+}
+
+// StreamText 按字符逐步回调，模拟流式输出
+func (p *StubProvider) StreamText(ctx context.Context, system string, prompt string, onPartial func(text string)) (string, error) {
+	text, err := p.CompleteText(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	if onPartial != nil {
+		runes := []rune(text)
+		for i := range runes {
+			onPartial(string(runes[:i+1]))
+		}
+	}
+	return text, nil
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ai
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"bvtc/ai/providers"
+	"bvtc/config"
+	"bvtc/response"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/semaphore"
+)
+
+var (
+	// 进程内共享的并发限制，所有请求和任务共用 Ai.concurrency 个名额
+	slots       *semaphore.Weighted
+	concurrency int64
+	inFlight    atomic.Int64
+	waiting     atomic.Int64
+
+	warmupRunning atomic.Bool
+	warmupMu      sync.Mutex
+	warmup        = make(map[string]WarmupState) // key 为链上 Provider 名称
+)
+
+// WarmupState 单个 Provider 最近一次预热的结果，最近一次成功时认为模型已加载
+type WarmupState struct {
+	Name      string     `json:"name"`
+	Warm      bool       `json:"warm"`
+	Running   bool       `json:"running"`
+	LastAt    *time.Time `json:"lastAt,omitempty"`
+	LatencyMs int64      `json:"latencyMs"`
+	LastError string     `json:"lastError,omitempty"`
+}
+
+// QueueStatus 大模型调用的排队情况
+type QueueStatus struct {
+	Concurrency int64 `json:"concurrency"`
+	InFlight    int64 `json:"inFlight"`
+	Waiting     int64 `json:"waiting"`
+}
+
+// initSlots 按 Ai.concurrency 创建共享的并发限制，小于 1 时按 1 处理
+func initSlots(n int64) {
+	if n < 1 {
+		n = 1
+	}
+	concurrency = n
+	slots = semaphore.NewWeighted(n)
+}
+
+// acquireSlot 获取一个调用名额，返回的函数用于归还
+func acquireSlot(ctx context.Context) (func(), error) {
+	if slots == nil {
+		return func() {}, nil
+	}
+	waiting.Add(1)
+	err := slots.Acquire(ctx, 1)
+	waiting.Add(-1)
+	if err != nil {
+		return nil, err
+	}
+	inFlight.Add(1)
+	return func() {
+		inFlight.Add(-1)
+		slots.Release(1)
+	}, nil
+}
+
+func queueStatus() QueueStatus {
+	return QueueStatus{
+		Concurrency: concurrency,
+		InFlight:    inFlight.Load(),
+		Waiting:     waiting.Load(),
+	}
+}
+
+func recordWarmup(name string, latency time.Duration, err error) {
+	warmupMu.Lock()
+	defer warmupMu.Unlock()
+	now := time.Now()
+	st := WarmupState{Name: name, LastAt: &now, LatencyMs: latency.Milliseconds()}
+	if err != nil {
+		// 预热失败说明模型当前不可用，之前成功过也视为未加载
+		st.LastError = err.Error()
+	} else {
+		st.Warm = true
+	}
+	warmup[name] = st
+}
+
+// warmupState 按链上顺序列出各 Provider 的预热结果，尚未预热的视为未加载
+func warmupState() []WarmupState {
+	if provider == nil {
+		return nil
+	}
+	warmupMu.Lock()
+	defer warmupMu.Unlock()
+	running := warmupRunning.Load()
+	out := make([]WarmupState, 0, len(provider.Members()))
+	for _, m := range provider.Members() {
+		st, ok := warmup[m.Name]
+		if !ok {
+			st = WarmupState{Name: m.Name}
+		}
+		st.Running = running
+		out = append(out, st)
+	}
+	return out
+}
+
+// AIStatus 获取 AI 子系统状态：Provider、预热、排队、熔断和缓存命中情况
+func AIStatus(c *gin.Context) {
+	AiCfg := config.GetConfig().Ai
+	data := gin.H{
+		"provider":  AiCfg.Provider,
+		"model":     AiCfg.Model,
+		"baseURL":   AiCfg.BaseURL,
+		"warmup":    warmupState(),
+		"queue":     queueStatus(),
+		"providers": ProviderStatus(),
+	}
+	if s, err := currentTitleService(); err == nil {
+		data["promptVersion"] = s.PromptVersion()
+		data["stats"] = s.Stats()
+	}
+	c.JSON(http.StatusOK, response.SuccessMsg(data))
+}
+
+// TriggerWarmup 重新触发预热，已有预热在进行时直接返回
+func TriggerWarmup(c *gin.Context) {
+	if _, err := currentProvider(); err != nil {
+		c.JSON(http.StatusServiceUnavailable, response.FailMsg("ai provider not available"))
+		return
+	}
+	if warmupRunning.Load() {
+		c.JSON(http.StatusConflict, response.FailMsg("warmup already running"))
+		return
+	}
+	go WarmupAITitle()
+	c.JSON(http.StatusOK, response.SuccessMsg(gin.H{"started": true}))
+}
+
+// modelStatus 单个 Ollama Provider 的模型拉取情况
+type modelStatus struct {
+	Name      string   `json:"name"`
+	Model     string   `json:"model"`
+	Available bool     `json:"available"`
+	Models    []string `json:"models,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// ModelStatus 通过 Ollama /api/tags 检查链上配置的模型是否已拉取，非 Ollama Provider 不检查
+func ModelStatus(c *gin.Context) {
+	if provider == nil {
+		c.JSON(http.StatusServiceUnavailable, response.FailMsg("ai provider not available"))
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	out := make([]modelStatus, 0)
+	for _, m := range provider.Members() {
+		op, ok := m.Provider.(*providers.OllamaProvider)
+		if !ok {
+			continue
+		}
+		st := modelStatus{Name: m.Name, Model: op.Model}
+		has, names, err := op.HasModel(ctx)
+		if err != nil {
+			st.Error = err.Error()
+		} else {
+			st.Available = has
+			st.Models = names
+		}
+		out = append(out, st)
+	}
+	c.JSON(http.StatusOK, response.SuccessMsg(out))
+}
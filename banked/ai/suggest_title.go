@@ -30,23 +30,53 @@ import (
 	"time"
 
 	"bvtc/ai/aititle"
-	"bvtc/ai/providers"
 	"bvtc/client"
-	"bvtc/config"
+	"bvtc/cloudnet"
+	"bvtc/log"
 	"bvtc/response"
 
 	"github.com/CuteReimu/bilibili/v2"
 	"github.com/gin-gonic/gin"
-	"golang.org/x/sync/semaphore"
 )
 
+// 标题建议模式
+const (
+	modeTitle    = "title"    // 只返回歌名文本
+	modeMetadata = "metadata" // 结构化返回歌名、原唱、演唱者和版本标记
+)
+
+// progressEvent SSE progress 事件
+type progressEvent struct {
+	Bvid           string                `json:"bvid"`
+	SuggestedTitle string                `json:"suggestedTitle,omitempty"`
+	Method         string                `json:"method,omitempty"` // rule 或 llm
+	Metadata       *aititle.Metadata     `json:"metadata,omitempty"`
+	Verification   *aititle.Verification `json:"verification,omitempty"` // verify=true 时的曲库验证结果
+	Error          string                `json:"error,omitempty"`
+}
+
+// partialEvent SSE partial 事件：大模型目前为止的输出，前端直接替换显示
+type partialEvent struct {
+	Bvid string `json:"bvid"`
+	Text string `json:"text"`
+}
+
 // SuggestTitleBatchStream 基于 SSE 的批量流式返回
+// 大模型生成过程中按 bvid 推送 partial 事件，完成后推送 progress 事件；
+// mode=metadata 时进行结构化抽取，progress 事件额外带上 metadata；
+// verify=true 时用网易云搜索验证建议，progress 事件额外带上候选歌曲
 func SuggestTitleBatchStream(c *gin.Context) {
 	bvidsParam := c.Query("bvids")
 	if bvidsParam == "" {
 		c.JSON(http.StatusBadRequest, response.FailMsg("invalid request: bvids required"))
 		return
 	}
+	verify := c.Query("verify") == "true"
+	mode := c.DefaultQuery("mode", modeTitle)
+	if mode != modeTitle && mode != modeMetadata {
+		c.JSON(http.StatusBadRequest, response.FailMsg("invalid request: unknown mode"))
+		return
+	}
 
 	// 基础 SSE 头
 	c.Writer.Header().Set("Content-Type", "text/event-stream")
@@ -96,28 +126,20 @@ func SuggestTitleBatchStream(c *gin.Context) {
 		return
 	}
 
-	AiCfg := config.GetConfig().Ai
-	baseURL := AiCfg.BaseURL
-	model := AiCfg.Model
-	timeout := AiCfg.Timeout
-	maxTitleLength := AiCfg.MaxTitleLength
-
-	var p aititle.Provider
-	p = providers.NewOllamaProvider(baseURL, model, timeout)
-
-	s := aititle.NewService(p, aititle.ServerConfig{
-		Model:          model,
-		Timeout:        timeout,
-		CacheTTL:       AiCfg.CacheTTL,
-		MaxTitleLength: maxTitleLength,
-	})
+	s, err := currentTitleService()
+	if err != nil {
+		writeEvent("error", map[string]any{"message": "ai provider not available"})
+		return
+	}
 
 	// 逐个视频独立处理，限制并发数
 	type item struct {
-		bvid   string
-		title  string
-		desc   string
-		errMsg string
+		bvid     string
+		title    string
+		desc     string
+		uploader string
+		duration time.Duration
+		errMsg   string
 	}
 
 	items := make([]item, 0, len(bvids))
@@ -129,29 +151,32 @@ func SuggestTitleBatchStream(c *gin.Context) {
 		} else {
 			it.title = ReplaceQuotes(videoinfo.Title)
 			it.desc = ReplaceQuotes(videoinfo.Desc)
+			it.uploader = videoinfo.Owner.Name
+			it.duration = time.Duration(videoinfo.Duration) * time.Second
 		}
 		items = append(items, it)
 	}
 
 	// 先发占位进度，避免前端长时间无反馈
 	for _, it := range items {
-		writeEvent("progress", struct {
-			Bvid           string `json:"bvid"`
-			SuggestedTitle string `json:"suggestedTitle,omitempty"`
-			Error          string `json:"error,omitempty"`
-		}{Bvid: it.bvid})
+		writeEvent("progress", progressEvent{Bvid: it.bvid})
 	}
 
 	// 结果通道，由主 goroutine 串行写 SSE，避免并发写
 	type result struct {
-		bvid   string
-		title  string
-		errMsg string
+		bvid     string
+		title    string
+		method   string
+		metadata *aititle.Metadata
+		verify   *aititle.Verification
+		errMsg   string
 	}
 	results := make(chan result, len(items))
+	// partial 事件是累计文本，通道满时直接丢弃，不阻塞生成
+	partials := make(chan partialEvent, 64)
 
-	// 并发控制（使用加权信号量）
-	sem := semaphore.NewWeighted(AiCfg.Concurrency)
+	// 客户端断开后不再排队和调用大模型，把名额让给其他请求和转换任务
+	reqCtx := c.Request.Context()
 	var wg sync.WaitGroup
 
 	for _, it := range items {
@@ -163,33 +188,60 @@ func SuggestTitleBatchStream(c *gin.Context) {
 				results <- result{bvid: it.bvid, errMsg: it.errMsg}
 				return
 			}
-			// 避免受 HTTP 连接影响
-			if err := sem.Acquire(context.Background(), 1); err != nil {
+			question := buildQuestion(it.title, it.desc)
+			if mode == modeMetadata {
+				question += "\nUP主：" + it.uploader
+			}
+			//log.Logger.Info("AI SuggestTitle request", log.String("question", question))
+
+			// 并发名额进程内共享，只在调用大模型期间占用，网易云验证不占名额
+			release, err := acquireSlot(reqCtx)
+			if err != nil {
 				results <- result{bvid: it.bvid, errMsg: "semaphore acquire failed: " + err.Error()}
 				return
 			}
-			defer sem.Release(1)
-
-			// 构造提示
-			var builder strings.Builder
-			builder.WriteString("标题：")
-			builder.WriteString(it.title)
-			builder.WriteString("\n简介：")
-			builder.WriteString(it.desc)
-			question := builder.String()
-			//log.Logger.Info("AI SuggestTitle request", log.String("question", question))
 
-			// 由 Service 内部超时控制
-			suggestedText, callErr := s.Suggest(context.Background(), question)
+			if mode == modeMetadata {
+				m, method, callErr := s.ExtractMetadataWithRules(reqCtx, it.bvid, it.title, question)
+				release()
+				if callErr != nil {
+					results <- result{bvid: it.bvid, errMsg: "AI 调用失败: " + callErr.Error()}
+					return
+				}
+				r := result{bvid: it.bvid, title: m.DisplayTitle(), method: method, metadata: &m}
+				if verify {
+					hint := m.OriginalArtist
+					if hint == "" {
+						hint = it.uploader
+					}
+					r.verify = verifySuggestion(m.Song, hint, it.duration)
+				}
+				results <- r
+				return
+			}
+
+			// 由 Service 内部超时控制，客户端断开时随请求取消
+			onPartial := func(text string) {
+				select {
+				case partials <- partialEvent{Bvid: it.bvid, Text: text}:
+				default:
+				}
+			}
+			suggestion, callErr := s.SuggestWithRulesStream(reqCtx, it.bvid, it.title, question, onPartial)
+			release()
 			if callErr != nil {
 				results <- result{bvid: it.bvid, errMsg: "AI 调用失败: " + callErr.Error()}
 				return
 			}
-			if strings.TrimSpace(suggestedText) == "" {
+			if strings.TrimSpace(suggestion.Title) == "" {
 				results <- result{bvid: it.bvid, errMsg: "AI 返回为空"}
 				return
 			}
-			results <- result{bvid: it.bvid, title: suggestedText}
+			r := result{bvid: it.bvid, title: suggestion.Title, method: suggestion.Method}
+			if verify {
+				r.verify = verifySuggestion(suggestion.Title, it.uploader, it.duration)
+			}
+			results <- r
 		}()
 	}
 
@@ -203,6 +255,8 @@ func SuggestTitleBatchStream(c *gin.Context) {
 	defer ticker.Stop()
 
 	remaining := len(items)
+	// 已完成的 bvid 不再推送滞后的 partial，避免覆盖最终结果
+	finished := make(map[string]bool, len(items))
 	for remaining > 0 {
 		select {
 		case r, ok := <-results:
@@ -210,16 +264,20 @@ func SuggestTitleBatchStream(c *gin.Context) {
 				remaining = 0
 				break
 			}
-			writeEvent("progress", struct {
-				Bvid           string `json:"bvid"`
-				SuggestedTitle string `json:"suggestedTitle,omitempty"`
-				Error          string `json:"error,omitempty"`
-			}{
+			writeEvent("progress", progressEvent{
 				Bvid:           r.bvid,
 				SuggestedTitle: r.title,
+				Method:         r.method,
+				Metadata:       r.metadata,
+				Verification:   r.verify,
 				Error:          r.errMsg,
 			})
+			finished[r.bvid] = true
 			remaining--
+		case p := <-partials:
+			if !finished[p.Bvid] {
+				writeEvent("partial", p)
+			}
 		case <-ticker.C:
 			writeEvent("ping", map[string]any{"t": time.Now().Unix()})
 		case <-c.Request.Context().Done():
@@ -230,6 +288,61 @@ func SuggestTitleBatchStream(c *gin.Context) {
 	writeEvent("done", map[string]any{"message": "completed"})
 }
 
+// 曲库验证返回的候选数量和搜索超时
+const (
+	verifyCandidates = 3
+	verifyTimeout    = 10 * time.Second
+)
+
+// verifySuggestion 用网易云搜索验证建议的歌名，搜索失败时返回 nil，不影响建议本身
+func verifySuggestion(title string, artistHint string, duration time.Duration) *aititle.Verification {
+	ctx, cancel := context.WithTimeout(context.Background(), verifyTimeout)
+	defer cancel()
+	songs, err := cloudnet.SearchSongs(ctx, title, 10)
+	if err != nil {
+		log.Logger.Warn("fail to verify title suggestion", log.String("title", title), log.Any("err", err))
+		return nil
+	}
+	cands := make([]aititle.Candidate, 0, len(songs))
+	for _, s := range songs {
+		cands = append(cands, aititle.Candidate{SongId: s.Id, Name: s.Name, Artists: s.Artists, Duration: s.Duration})
+	}
+	v := aititle.RankCandidates(title, artistHint, duration, cands, verifyCandidates)
+	return &v
+}
+
+// SuggestTaskTitle 转换任务中在服务端生成标题，先规则解析，必要时调用大模型
+func SuggestTaskTitle(ctx context.Context, bvid string, title string, desc string) (aititle.Suggestion, error) {
+	s, err := currentTitleService()
+	if err != nil {
+		return aititle.Suggestion{}, err
+	}
+	title, desc = ReplaceQuotes(title), ReplaceQuotes(desc)
+	release, err := acquireSlot(ctx)
+	if err != nil {
+		return aititle.Suggestion{}, err
+	}
+	defer release()
+	suggestion, err := s.SuggestWithRules(ctx, bvid, title, buildQuestion(title, desc))
+	if err != nil {
+		return aititle.Suggestion{}, err
+	}
+	if strings.TrimSpace(suggestion.Title) == "" {
+		return aititle.Suggestion{}, fmt.Errorf("AI 返回为空")
+	}
+	return suggestion, nil
+}
+
+// buildQuestion 构造提问内容：标题和简介
+func buildQuestion(title string, desc string) string {
+	var builder strings.Builder
+	builder.WriteString("标题：")
+	builder.WriteString(title)
+	builder.WriteString("\n简介：")
+	builder.WriteString(desc)
+	return builder.String()
+}
+
 // ReplaceQuotes 将不应该的字符全部替换为单引号
 func ReplaceQuotes(s string) string {
 	s = strings.ReplaceAll(s, "\"", "'")
@@ -237,3 +350,31 @@ func ReplaceQuotes(s string) string {
 	s = strings.ReplaceAll(s, "”", "'")
 	return s
 }
+
+// InvalidateSuggestions 删除指定视频的标题建议缓存，前端“重新生成”前调用
+func InvalidateSuggestions(c *gin.Context) {
+	var req struct {
+		Bvids []string `json:"bvids"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Bvids) == 0 {
+		c.JSON(http.StatusBadRequest, response.FailMsg("invalid request: bvids required"))
+		return
+	}
+	s, err := currentTitleService()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, response.FailMsg("ai provider not available"))
+		return
+	}
+	for _, bvid := range req.Bvids {
+		bvid = strings.TrimSpace(bvid)
+		if bvid == "" {
+			continue
+		}
+		if err := s.Invalidate(c.Request.Context(), bvid); err != nil {
+			log.Logger.Warn("fail to invalidate title suggestion", log.String("bvid", bvid), log.Any("err", err))
+			c.JSON(http.StatusInternalServerError, response.FailMsg("invalidate fail"))
+			return
+		}
+	}
+	c.JSON(http.StatusOK, response.SuccessMsg(nil))
+}
@@ -25,32 +25,47 @@ import (
 	"time"
 
 	"bvtc/ai/providers"
-	"bvtc/config"
 	"bvtc/log"
 )
 
-// WarmupAITitle 进程启动后预热一次模型，避免首次调用超时
+// WarmupAITitle 进程启动后逐个预热链上的 Provider，避免首次调用超时；
+// 也可以通过 AI 状态接口重新触发，同一时间只运行一次。
+// 预热直接调用各 Provider，不经过 Provider 链：备用 Provider 成功不代表主 Provider 已加载，
+// 预热失败也不计入熔断
 func WarmupAITitle() {
-	AiCfg := config.GetConfig().Ai
-	p := providers.NewOllamaProvider(AiCfg.BaseURL, AiCfg.Model, AiCfg.Timeout)
+	if provider == nil {
+		log.Logger.Warn("AI warmup skipped", log.String("error", "ai provider is not initialized"))
+		return
+	}
+	if !warmupRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer warmupRunning.Store(false)
+
+	for _, m := range provider.Members() {
+		warmupMember(m)
+	}
+}
 
+func warmupMember(m providers.ChainMember) {
 	warmupTimeout := 60 * time.Second
 
 	ctx, cancel := context.WithTimeout(context.Background(), warmupTimeout)
 	defer cancel()
 
 	// 轻提示：不关心输出内容，只为触发模型加载
-	if _, err := p.CompleteText(ctx, "你好"); err != nil {
+	start := time.Now()
+	_, err := m.Provider.CompleteText(ctx, "你好")
+	recordWarmup(m.Name, time.Since(start), err)
+	if err != nil {
 		log.Logger.Warn("AI warmup failed",
-			log.String("baseURL", AiCfg.BaseURL),
-			log.String("model", AiCfg.Model),
+			log.String("provider", m.Name),
 			log.Int("timeoutSeconds", int(warmupTimeout/time.Second)),
 			log.String("error", err.Error()),
 		)
 		return
 	}
 	log.Logger.Info("AI warmup success",
-		log.String("baseURL", AiCfg.BaseURL),
-		log.String("model", AiCfg.Model),
+		log.String("provider", m.Name),
 	)
 }
@@ -18,68 +18,236 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
 // SOFTWARE.
 
-// Package bilibili用于用户自行登录
-// Note: 暂时不用这部分,如果后续需要登录,可以参考这个文件
 package bilibili
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
-	"os"
+	"time"
 
 	"bvtc/client"
 	"bvtc/log"
 	"bvtc/response"
+	"bvtc/tool/credential"
+	redis_pool "bvtc/tool/pool"
+	"bvtc/tool/session"
+	"bvtc/tool/socket"
 
 	"github.com/CuteReimu/bilibili/v2"
 	"github.com/gin-gonic/gin"
 )
 
+// 哔哩哔哩扫码登录轮询返回码
+const (
+	biliQrcodeSuccess   = 0
+	biliQrcodeExpired   = 86038
+	biliQrcodeScanned   = 86090 // 已扫码未确认
+	biliQrcodeNotScaned = 86101
+)
+
+// 登录后请求的清晰度（1080P），durl 中的音频码率也更高
+const biliLoginQn = 80
+
+// biliCredential 加密保存的哔哩哔哩 cookie
+type biliCredential struct {
+	Cookies string `json:"cookies"`
+}
+
+func biliQrcodeKey(sid string) string {
+	return "biliqr:" + sid
+}
+
+// BiliLogin 生成哔哩哔哩登录二维码，扫码状态通过 BiliLoginCheck 的 websocket 推送
 func BiliLogin(ctx *gin.Context) {
-	cli, _ := client.GetBiliClient()
-	qrCode, _ := cli.GetQRCode()
-	buf, _ := qrCode.Encode()
-	os.WriteFile("qrcode.png", buf, 0o644)
-	result, err := cli.LoginWithQRCode(bilibili.LoginWithQRCodeParam{
-		QrcodeKey: qrCode.QrcodeKey,
-	})
-	if err != nil || result.Code != 0 {
-		log.Logger.Error("登录失败", log.Any("err", err))
-		ctx.JSON(http.StatusOK, response.FailMsg("登录失败"))
+	sid, err := ctx.Cookie("SessionId")
+	if err != nil {
+		log.Logger.Error("fail to get sessionId", log.Any("err : ", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to get sessionId"))
 		return
 	}
-	cookiesString := cli.GetCookiesString()
 
-	// 确保data目录存在
-	if err := os.MkdirAll("./bilibili/data", 0o755); err != nil {
-		log.Logger.Error("创建data目录失败", log.Any("err", err))
-		ctx.JSON(http.StatusOK, response.FailMsg("保存cookie失败"))
+	qrCode, err := bilibili.New().GetQRCode()
+	if err != nil {
+		log.Logger.Error("fail to create bilibili qrcode", log.Any("err", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to create qrcode"))
+		return
+	}
+	buf, err := qrCode.Encode()
+	if err != nil {
+		log.Logger.Error("fail to encode bilibili qrcode", log.Any("err", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to create qrcode"))
 		return
 	}
 
-	// 保存cookie到文件
-	if err := os.WriteFile("./bilibili/data/cookies.txt", []byte(cookiesString), 0o644); err != nil {
-		log.Logger.Error("保存cookie失败", log.Any("err", err))
-		ctx.JSON(http.StatusOK, response.FailMsg("保存cookie失败"))
+	rdb := redis_pool.GetRdb()
+	rtcx := redis_pool.GetRctx()
+	if err := rdb.Set(rtcx, biliQrcodeKey(sid), qrCode.QrcodeKey, 3*time.Minute).Err(); err != nil {
+		log.Logger.Error("redis fail to set", log.Any("err : ", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("redis fail to set"))
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-cache, no-store")
+	ctx.Data(http.StatusOK, "image/png", buf)
+}
+
+// BiliLoginCheck 轮询扫码状态并通过 websocket 推送，状态码与网易云二维码登录一致
+func BiliLoginCheck(ctx *gin.Context) {
+	sid, err := ctx.Cookie("SessionId")
+	if err != nil {
+		log.Logger.Error("fail to get sessionId", log.Any("err : ", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to get sessionId"))
+		return
+	}
+	rdb := redis_pool.GetRdb()
+	rtcx := redis_pool.GetRctx()
+	qrcodeKey, err := rdb.Get(rtcx, biliQrcodeKey(sid)).Result()
+	if err != nil {
+		log.Logger.Error("qrcode key not found", log.Any("err : ", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("qrcode key not found"))
+		return
+	}
+
+	wsClient, err := socket.Upgrade(ctx, sid)
+	if err != nil {
+		log.Logger.Error("upgrade websocket failed", log.Any("err", err), log.String("sid", sid))
 		return
 	}
+	defer wsClient.Close()
+	defer rdb.Del(rtcx, biliQrcodeKey(sid))
 
-	log.Logger.Info("登录成功", log.Any("cookies", cookiesString))
-	ctx.JSON(http.StatusOK, response.SuccessMsg("登录成功"))
+	// 登录成功后 cookie 保存在轮询使用的客户端中
+	cli := bilibili.New()
+	pollCtx, cancel := context.WithTimeout(ctx.Request.Context(), 3*time.Minute)
+	defer cancel()
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	lastCode := -1
+	for {
+		result, err := cli.LoginWithQRCode(bilibili.LoginWithQRCodeParam{QrcodeKey: qrcodeKey})
+		if err != nil {
+			log.Logger.Error("fail to check bilibili qrcode", log.Any("err", err))
+			sendSocketResponse(wsClient, sid, 500, "fail to login", nil)
+			return
+		}
+		if result.Code != lastCode {
+			lastCode = result.Code
+			switch result.Code {
+			case biliQrcodeNotScaned:
+				sendSocketResponse(wsClient, sid, 801, "waiting for scan", nil)
+			case biliQrcodeScanned:
+				sendSocketResponse(wsClient, sid, 802, "waiting for confirm", nil)
+			case biliQrcodeExpired:
+				sendSocketResponse(wsClient, sid, 800, "qr is not exist or expired", nil)
+				return
+			case biliQrcodeSuccess:
+				if err := saveBiliCookies(sid, cli.GetCookiesString()); err != nil {
+					log.Logger.Error("fail to save bilibili cookies", log.Any("err", err))
+					sendSocketResponse(wsClient, sid, 500, "保存cookie失败", nil)
+					return
+				}
+				log.Logger.Info("bilibili login success", log.String("sid", sid))
+				sendSocketResponse(wsClient, sid, 200, "success to login", nil)
+				return
+			default:
+				log.Logger.Error("unknown bilibili qrcode status", log.Any("result", result))
+				sendSocketResponse(wsClient, sid, 500, "unknown qrcode status", nil)
+				return
+			}
+		}
+
+		select {
+		case <-wsClient.Done():
+			return
+		case <-pollCtx.Done():
+			if errors.Is(pollCtx.Err(), context.DeadlineExceeded) {
+				sendSocketResponse(wsClient, sid, 408, "request timeout", nil)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
 }
 
-func BiliLoginWithCookie(ctx *gin.Context) {
-	cli, _ := client.GetBiliClient()
+// BiliLoginStatus 查询当前会话是否已登录哔哩哔哩
+func BiliLoginStatus(ctx *gin.Context) {
+	sid, err := ctx.Cookie("SessionId")
+	if err != nil {
+		log.Logger.Error("fail to get sessionId", log.Any("err : ", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to get sessionId"))
+		return
+	}
+	_, loggedIn, err := biliClientForSession(sid)
+	if err != nil {
+		log.Logger.Error("fail to load bilibili client", log.Any("err", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to load bilibili client"))
+		return
+	}
+	ctx.JSON(http.StatusOK, response.SuccessMsg(gin.H{"loggedIn": loggedIn}))
+}
 
-	// 读取cookie文件
-	cookiestring, err := os.ReadFile("./bilibili/data/cookies.txt")
+// BiliLogout 删除当前会话的哔哩哔哩登录状态
+func BiliLogout(ctx *gin.Context) {
+	sid, err := ctx.Cookie("SessionId")
 	if err != nil {
-		log.Logger.Error("读取cookie文件失败", log.Any("err", err))
-		ctx.JSON(http.StatusOK, response.FailMsg("读取cookie失败"))
+		log.Logger.Error("fail to get sessionId", log.Any("err : ", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to get sessionId"))
 		return
 	}
-	// 设置cookie
-	cli.SetCookiesString(string(cookiestring))
+	if err := session.DelBiliCredential(sid); err != nil {
+		log.Logger.Error("fail to delete bilibili cookies", log.Any("err", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to logout"))
+		return
+	}
+	ctx.JSON(http.StatusOK, response.SuccessMsg(""))
+}
 
-	log.Logger.Info("使用cookie登录成功", log.Any("cookies", string(cookiestring)))
-	ctx.JSON(http.StatusOK, response.SuccessMsg("登录成功"))
+// saveBiliCookies 加密保存 cookie，并记录到会话中
+func saveBiliCookies(sid string, cookies string) error {
+	if cookies == "" {
+		return errors.New("bilibili cookies is empty")
+	}
+	name, err := session.BiliCredentialName(sid)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(biliCredential{Cookies: cookies})
+	if err != nil {
+		return err
+	}
+	if err := credential.Put(name, b); err != nil {
+		return err
+	}
+	return session.SetBiliCredential(sid, name)
+}
+
+// biliClientForSession 会话已登录哔哩哔哩时返回带 cookie 的客户端，否则返回共享的匿名客户端
+func biliClientForSession(sid string) (cli *bilibili.Client, loggedIn bool, err error) {
+	name := session.GetBiliCredential(sid)
+	if name != "" {
+		raw, err := credential.Get(name)
+		if err == nil {
+			var cred biliCredential
+			if err := json.Unmarshal(raw, &cred); err == nil && cred.Cookies != "" {
+				cli = bilibili.New()
+				cli.SetCookiesString(cred.Cookies)
+				return cli, true, nil
+			}
+		}
+		log.Logger.Warn("fail to load bilibili cookies, fallback to anonymous client", log.String("sid", sid), log.Any("err", err))
+	}
+	cli, err = client.GetBiliClient()
+	return cli, false, err
+}
+
+func sendSocketResponse(wsClient *socket.Client, sid string, code int, msg string, data interface{}) bool {
+	payload := response.Msg(code, msg, data)
+	if err := wsClient.SendJSON(payload); err != nil {
+		log.Logger.Error("failed to send websocket message", log.Any("err", err), log.String("sid", sid), log.Any("payload", payload))
+		return false
+	}
+	return true
 }
@@ -121,7 +121,7 @@ func DownloadVideo(ctx *gin.Context) {
 	}
 	audioreq.CoverArt = coverfilename
 
-	err = TranslateVideoToAudio(audioreq, false, 0, "")
+	_, err = TranslateVideoToAudio(audioreq, "", nil)
 	if err != nil {
 		log.Logger.Error("translate video to audio fail", log.Any("err", err))
 		ctx.JSON(http.StatusInternalServerError, response.FailMsg("translate video to audio fail"))
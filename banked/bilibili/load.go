@@ -26,17 +26,21 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"bvtc/ai"
+	"bvtc/ai/aititle"
 	"bvtc/client"
+	"bvtc/cloudnet"
 	"bvtc/config"
 	"bvtc/constant"
 	"bvtc/log"
 	"bvtc/response"
-	redis_pool "bvtc/tool/pool"
 	"bvtc/tool/randomstring"
+	"bvtc/tool/session"
 
 	"github.com/CuteReimu/bilibili/v2"
 	"github.com/gin-gonic/gin"
@@ -45,24 +49,34 @@ import (
 )
 
 type VideoStreamReq struct {
-	Bvid          []string          `json:"bvid"`                    // 稿件 bvid
-	Splaylist     bool              `json:"splaylist"`               // 是否上传到歌单
-	Pid           int64             `json:"pid,omitempty"`           // 歌单 id
-	TitleOverride map[string]string `json:"titleOverride,omitempty"` // 可选：自定义标题，key 为 bvid
+	Bvid             []string                    `json:"bvid"`                       // 稿件 bvid
+	Splaylist        bool                        `json:"splaylist"`                  // 是否上传到歌单
+	Pid              int64                       `json:"pid,omitempty"`              // 歌单 id
+	TitleOverride    map[string]string           `json:"titleOverride,omitempty"`    // 可选：自定义标题，key 为 bvid
+	MetadataOverride map[string]aititle.Metadata `json:"metadataOverride,omitempty"` // 可选：AI 结构化抽取结果，key 为 bvid，titleOverride 优先
+	Position         string                      `json:"position,omitempty"`         // 歌单插入位置：top（默认）或 bottom
+	TitleMode        string                      `json:"titleMode,omitempty"`        // 标题来源：original（默认）、ai 或 ai-with-fallback，titleOverride 优先
+	Bitrate          int                         `json:"bitrate,omitempty"`          // 输出比特率 kbps：128/192/256/320，默认取配置
+	DryRun           bool                        `json:"dryRun,omitempty"`           // 只做预检，不创建任务
+	Account          int64                       `json:"account,omitempty"`          // 目标网易云账号 uid，默认使用会话当前账号
 }
 
 // 任务结构体
 type LoadMP4Task struct {
-	ID        string         `json:"id"`         // 任务ID
-	Status    string         `json:"status"`     // 任务状态
-	Progress  int            `json:"progress"`   // 进度百分比 (0-100)
-	Total     int            `json:"total"`      // 总文件数
-	Success   []string       `json:"success"`    // 成功处理的视频标题
-	Failed    []failed       `json:"failed"`     // 失败处理的视频
-	Error     string         `json:"error"`      // Status为failed时，错误信息
-	CreatedAt time.Time      `json:"created_at"` // 创建时间
-	UpdatedAt time.Time      `json:"updated_at"` // 更新时间
-	Request   VideoStreamReq `json:"request"`    // 原始请求
+	ID        string           `json:"id"`         // 任务ID
+	Status    string           `json:"status"`     // 任务状态
+	Progress  int              `json:"progress"`   // 进度百分比 (0-100)
+	Total     int              `json:"total"`      // 总文件数
+	Success   []string         `json:"success"`    // 成功处理的视频标题
+	Failed    []failed         `json:"failed"`     // 失败处理的视频
+	Results   []TaskItemResult `json:"results"`    // 按请求顺序的逐项结果，包含网易云歌曲ID
+	Error     string           `json:"error"`      // Status为failed时，错误信息
+	CreatedAt time.Time        `json:"created_at"` // 创建时间
+	UpdatedAt time.Time        `json:"updated_at"` // 更新时间
+	Request   VideoStreamReq   `json:"request"`    // 原始请求
+
+	pending int   // 已上传到云盘、等待批量加入歌单的数量
+	owner   int64 // 创建任务时使用的网易云账号
 }
 
 // 失败处理的视频
@@ -82,8 +96,11 @@ var taskManager = &TaskManager{
 }
 
 type result struct {
-	Title string
-	Err   error
+	Index  int // 在请求中的顺序，用于保持歌单顺序
+	Title  string
+	SongId int64
+	Err    error
+	Item   TaskItemResult // 报告中的逐项结果
 }
 
 // CreateLoadMP4Task 创建上传任务
@@ -101,10 +118,8 @@ func CreateLoadMP4Task(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to get sessionId"))
 		return
 	}
-	rdb := redis_pool.GetRdb()
-	rtcx := redis_pool.GetRctx()
-	key := "session:" + sid
-	cookieFile, rerr := rdb.HGet(rtcx, key, "cookieFile").Result()
+	// 未指定账号时使用会话当前账号
+	cookieFile, rerr := session.ResolveCookieFile(sid, req.Account)
 	if rerr != nil || cookieFile == "" {
 		log.Logger.Error("session not found or expired", log.Any("err : ", rerr))
 		ctx.JSON(http.StatusBadRequest, response.FailMsg("session not found or expired"))
@@ -123,14 +138,82 @@ func CreateLoadMP4Task(ctx *gin.Context) {
 		return
 	}
 
+	switch req.Position {
+	case "":
+		req.Position = constant.PlaylistPositionTop
+	case constant.PlaylistPositionTop, constant.PlaylistPositionBottom:
+	default:
+		log.Logger.Error("invalid position", log.String("position", req.Position))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("position must be top or bottom"))
+		return
+	}
+
+	switch req.TitleMode {
+	case "":
+		req.TitleMode = constant.TitleModeOriginal
+	case constant.TitleModeOriginal, constant.TitleModeAI, constant.TitleModeAIWithFallback:
+	default:
+		log.Logger.Error("invalid title mode", log.String("titleMode", req.TitleMode))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("titleMode must be original, ai or ai-with-fallback"))
+		return
+	}
+
+	if req.Bitrate == 0 {
+		req.Bitrate = defaultBitrate()
+	}
+	if !allowedBitrates[req.Bitrate] {
+		log.Logger.Error("invalid bitrate", log.Int("bitrate", req.Bitrate))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("bitrate must be one of 128, 192, 256, 320"))
+		return
+	}
+
+	// 已登录哔哩哔哩时使用用户自己的客户端，可获取会员专享和更高画质的视频流
+	cli, loggedIn, err := biliClientForSession(sid)
+	if err != nil {
+		log.Logger.Error("client init fail", log.Any("err", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("client init fail"))
+		return
+	}
+	uid, err := cloudnet.GetAccountId(cookieFile)
+	if err != nil {
+		log.Logger.Error("fail to get account id", log.Any("err", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg(err.Error()))
+		return
+	}
+
+	// 登录失效的账号暂停新建任务（已在运行的任务不受影响），重新登录后恢复
+	if session.CredentialExpired(cookieFile) || session.AccountJobsPaused(uid) {
+		log.Logger.Info("account jobs paused, need relogin", log.Any("uid", uid))
+		ctx.JSON(http.StatusUnauthorized, response.FailCodeMsg(constant.CodeReloginRequired, "网易云登录已失效，请重新登录"))
+		return
+	}
+
+	// 预检：容量、预估大小、重复上传，在任何下载开始前返回给用户
+	preflight := runPreflight(cli, req, cookieFile, uid)
+	if req.DryRun {
+		ctx.JSON(http.StatusOK, response.SuccessMsg(gin.H{"preflight": preflight}))
+		return
+	}
+	if !preflight.Fits {
+		log.Logger.Info("cloud storage is not enough",
+			log.Any("estimated", preflight.EstimatedTotal),
+			log.Any("available", preflight.CloudAvailable))
+		ctx.JSON(http.StatusBadRequest, response.Msg(-1, "cloud storage is not enough", gin.H{"preflight": preflight}))
+		return
+	}
+
 	// 创建任务
-	task := taskManager.createTask(req)
+	task := taskManager.createTask(req, uid)
 
 	// 启动异步处理
-	go LoadMP4Async(task.ID, cookieFile)
+	qn := 0
+	if loggedIn {
+		qn = biliLoginQn
+	}
+	go LoadMP4Async(task.ID, cookieFile, uid, cli, qn)
 
 	// 返回任务ID
-	ctx.JSON(http.StatusOK, response.SuccessMsg(map[string]string{"task_id": task.ID}))
+	ctx.JSON(http.StatusOK, response.SuccessMsg(gin.H{"task_id": task.ID, "preflight": preflight}))
 }
 
 // CheckLoadMP4Task 查询任务状态
@@ -179,17 +262,20 @@ func CheckLoadMP4Task(ctx *gin.Context) {
 }
 
 // processLoadMP4Task 异步处理任务
-func LoadMP4Async(taskID string, cookiefile string) {
+// cli 为会话对应的哔哩哔哩客户端，qn 为请求的清晰度，0 表示默认
+func LoadMP4Async(taskID string, cookiefile string, uid int64, cli *bilibili.Client, qn int) {
 	task, _ := taskManager.getTask(taskID)
 	// 更新状态为运行中
 	taskManager.updateTask(taskID, constant.TaskStatusRunning, 0, "")
 
-	cli, err := client.GetBiliClient()
+	// 整个任务共用同一个已认证的网易云客户端，任务结束前不会被淘汰
+	_, release, err := client.AcquireNetcloudApi(cookiefile)
 	if err != nil {
-		log.Logger.Error("client init fail", log.Any("err", err))
+		log.Logger.Error("netcloud client init fail", log.Any("err", err))
 		taskManager.updateTask(taskID, constant.TaskStatusFailed, 0, err.Error())
 		return
 	}
+	defer release()
 
 	var wg sync.WaitGroup
 	sem := semaphore.NewWeighted(config.GetConfig().Music.Concurrency)
@@ -207,91 +293,7 @@ func LoadMP4Async(taskID string, cookiefile string) {
 			defer wg.Done()
 			defer sem.Release(1)
 
-			videoinfo, err := cli.GetVideoInfo(bilibili.VideoParam{Bvid: bvid})
-			if err != nil {
-				// cannot reference videoinfo when err != nil; use bvid as title fallback
-				resultChan <- result{Title: bvid, Err: fmt.Errorf("get video info fail: %v", err)}
-				return
-			}
-			cid := videoinfo.Cid
-
-			stream, err := cli.GetVideoStream(bilibili.GetVideoStreamParam{Bvid: bvid, Cid: cid})
-			if err != nil {
-				resultChan <- result{Title: videoinfo.Title, Err: fmt.Errorf("get video stream fail: %v", err)}
-				return
-			}
-
-			// 应用可选的标题覆盖
-			title := videoinfo.Title
-			if task != nil && task.Request.TitleOverride != nil {
-				if t, ok := task.Request.TitleOverride[bvid]; ok {
-					t = strings.TrimSpace(t)
-					if t != "" {
-						title = t
-					}
-				}
-			}
-			title = sanitizeFilename(title)
-			url := stream.Durl[0].Url
-			filename := filepath.Join(constant.Filepath, fmt.Sprintf("%s.mp4", title))
-			defer os.Remove(filename)
-
-			err = os.MkdirAll(constant.Filepath, 0o755)
-			if err != nil {
-				resultChan <- result{Title: videoinfo.Title, Err: fmt.Errorf("创建输出目录失败: %v", err)}
-				return
-			}
-
-			referer := cli.Resty().Header.Get("Referer")
-			useragent := cli.Resty().Header.Get("User-Agent")
-			resp, err := resty.New().R().
-				SetHeader("User-Agent", useragent).
-				SetHeader("Referer", referer).
-				SetOutput(filename).
-				Get(url)
-			if err != nil {
-				resultChan <- result{Title: videoinfo.Title, Err: fmt.Errorf("下载失败: %v", err)}
-				return
-			}
-			if resp.StatusCode() != 200 {
-				resultChan <- result{Title: videoinfo.Title, Err: fmt.Errorf("请求失败: status code %d", resp.StatusCode())}
-				return
-			}
-
-			var audioreq AudioReq
-			audioreq.Filename = filename
-			audioreq.Artist = videoinfo.Owner.Name
-			audioreq.Title = title
-
-			mid := videoinfo.Owner.Mid
-			artistinfo, err := cli.GetUserCard(bilibili.GetUserCardParam{Mid: mid})
-			if err != nil {
-				resultChan <- result{Title: videoinfo.Title, Err: fmt.Errorf("获取用户空间详情失败: %v", err)}
-				return
-			}
-			coverurl := artistinfo.Card.Face
-			coverfilename := filepath.Join(constant.Filepath, fmt.Sprintf("%s.jpeg", randomstring.GenerateRandomString(16)))
-			defer os.Remove(coverfilename)
-			coverresp, err := resty.New().R().
-				SetOutput(coverfilename).
-				Get(coverurl)
-			if err != nil {
-				resultChan <- result{Title: videoinfo.Title, Err: fmt.Errorf("下载封面失败: %v", err)}
-				return
-			}
-			if coverresp.StatusCode() != 200 {
-				resultChan <- result{Title: videoinfo.Title, Err: fmt.Errorf("请求封面失败: status code %d", coverresp.StatusCode())}
-				return
-			}
-			audioreq.CoverArt = coverfilename
-
-			err = TranslateVideoToAudio(audioreq, task.Request.Splaylist, task.Request.Pid, cookiefile)
-			if err != nil {
-				resultChan <- result{Title: videoinfo.Title, Err: fmt.Errorf("上传失败: %v", err)}
-				return
-			}
-
-			resultChan <- result{Title: title, Err: nil}
+			resultChan <- processVideo(cli, task.Request, index, bvid, cookiefile, uid, qn)
 		}(i, bvid)
 	}
 
@@ -301,26 +303,255 @@ func LoadMP4Async(taskID string, cookiefile string) {
 		close(resultChan)
 	}()
 
-	// 收集处理结果
+	// 收集处理结果，需要加入歌单的先暂存，最后统一批量添加
+	var uploaded []result
 	for result := range resultChan {
 		if result.Err != nil {
+			result.Item.Status = constant.ItemStatusFailed
+			result.Item.Error = result.Err.Error()
+			taskManager.setResult(taskID, result.Item)
 			taskManager.addFailed(taskID, failed{
 				Title: result.Title,
 				Error: result.Err.Error(),
 			})
+		} else if task.Request.Splaylist {
+			uploaded = append(uploaded, result)
+			taskManager.addPending(taskID)
 		} else {
+			result.Item.Status = constant.ItemStatusSuccess
+			taskManager.setResult(taskID, result.Item)
 			taskManager.addSuccess(taskID, result.Title)
 		}
 	}
 
+	if len(uploaded) > 0 {
+		addUploadedToPlaylist(taskID, task.Request, uploaded, cookiefile)
+	}
+
 	// 更新最终状态
 	taskManager.updateTask(taskID, constant.TaskStatusCompleted, 100, "")
+
+	// 持久化任务报告，任务被查询清理后仍可下载
+	if report, ok := taskManager.snapshotReport(taskID); ok {
+		if err := saveTaskReport(report); err != nil {
+			log.Logger.Warn("fail to save task report", log.String("taskId", taskID), log.Any("err", err))
+		}
+	}
+}
+
+// processVideo 下载单个视频、转换并上传到云盘，结果中记录各阶段耗时
+func processVideo(cli *bilibili.Client, req VideoStreamReq, index int, bvid string, cookiefile string, uid int64, qn int) result {
+	item := TaskItemResult{
+		Index:   index,
+		Bvid:    bvid,
+		Format:  "mp3",
+		Bitrate: req.Bitrate,
+		Stages:  make([]StageTiming, 0, len(reportStages)),
+	}
+	// fail 记录失败阶段并返回结果，title 为空时使用 bvid
+	fail := func(title string, err error) result {
+		if title == "" {
+			title = bvid
+		}
+		return result{Index: index, Title: title, Err: err, Item: item}
+	}
+
+	end := item.beginStage(StageInfo)
+	videoinfo, err := cli.GetVideoInfo(bilibili.VideoParam{Bvid: bvid})
+	end(err)
+	if err != nil {
+		// cannot reference videoinfo when err != nil; use bvid as title fallback
+		return fail("", fmt.Errorf("get video info fail: %v", err))
+	}
+	cid := videoinfo.Cid
+	item.Cid = cid
+	item.OriginalTitle = videoinfo.Title
+	item.Artist = videoinfo.Owner.Name
+	item.Duration = videoinfo.Duration
+
+	end = item.beginStage(StageStream)
+	stream, err := cli.GetVideoStream(bilibili.GetVideoStreamParam{Bvid: bvid, Cid: cid, Qn: qn})
+	end(err)
+	if err != nil {
+		return fail(videoinfo.Title, fmt.Errorf("get video stream fail: %v", err))
+	}
+
+	// 应用可选的元数据、标题覆盖
+	title := videoinfo.Title
+	item.TitleSource = titleSourceOriginal
+	artist := videoinfo.Owner.Name
+	var originalArtist string
+	if m, ok := req.MetadataOverride[bvid]; ok {
+		if t := m.DisplayTitle(); strings.TrimSpace(t) != "" {
+			title = t
+			item.TitleSource = titleSourceOverride
+		}
+		if p := strings.TrimSpace(m.Performer); p != "" {
+			artist = p
+		}
+		originalArtist = strings.TrimSpace(m.OriginalArtist)
+	}
+	item.Artist = artist
+	if req.TitleOverride != nil {
+		if t, ok := req.TitleOverride[bvid]; ok {
+			t = strings.TrimSpace(t)
+			if t != "" {
+				title = t
+				item.TitleSource = titleSourceOverride
+			}
+		}
+	}
+	// 没有显式覆盖时按 titleMode 在服务端生成标题
+	if item.TitleSource == titleSourceOriginal && req.TitleMode != "" && req.TitleMode != constant.TitleModeOriginal {
+		end = item.beginStage(StageTitle)
+		suggestion, err := ai.SuggestTaskTitle(context.Background(), bvid, videoinfo.Title, videoinfo.Desc)
+		end(err)
+		switch {
+		case err == nil:
+			title = suggestion.Title
+			item.SuggestedTitle = suggestion.Title
+			item.TitleSource = suggestion.Method
+		case req.TitleMode == constant.TitleModeAI:
+			return fail(videoinfo.Title, fmt.Errorf("AI 生成标题失败: %v", err))
+		default:
+			log.Logger.Warn("AI title failed, fallback to original", log.String("bvid", bvid), log.Any("err", err))
+		}
+	}
+	title = sanitizeFilename(title)
+	item.Title = title
+	url := stream.Durl[0].Url
+	// 工作文件不用标题命名：同一批次的多个翻唱可能得到相同的标题，并发处理时会互相覆盖。
+	// 标题只用于标签和上传到云盘的文件名
+	filename := filepath.Join(constant.Filepath, fmt.Sprintf("%s_%s.mp4", bvid, randomstring.GenerateRandomString(8)))
+	defer os.Remove(filename)
+
+	err = os.MkdirAll(constant.Filepath, 0o755)
+	if err != nil {
+		return fail(videoinfo.Title, fmt.Errorf("创建输出目录失败: %v", err))
+	}
+
+	end = item.beginStage(StageDownload)
+	referer := cli.Resty().Header.Get("Referer")
+	useragent := cli.Resty().Header.Get("User-Agent")
+	resp, err := resty.New().R().
+		SetHeader("User-Agent", useragent).
+		SetHeader("Referer", referer).
+		SetOutput(filename).
+		Get(url)
+	if err != nil {
+		end(err)
+		return fail(videoinfo.Title, fmt.Errorf("下载失败: %v", err))
+	}
+	if resp.StatusCode() != 200 {
+		err = fmt.Errorf("请求失败: status code %d", resp.StatusCode())
+		end(err)
+		return fail(videoinfo.Title, err)
+	}
+	end(nil)
+
+	var audioreq AudioReq
+	audioreq.Filename = filename
+	audioreq.Artist = artist
+	audioreq.OriginalArtist = originalArtist
+	audioreq.Title = title
+	audioreq.Bitrate = req.Bitrate
+
+	end = item.beginStage(StageCover)
+	mid := videoinfo.Owner.Mid
+	artistinfo, err := cli.GetUserCard(bilibili.GetUserCardParam{Mid: mid})
+	if err != nil {
+		end(err)
+		return fail(videoinfo.Title, fmt.Errorf("获取用户空间详情失败: %v", err))
+	}
+	coverurl := artistinfo.Card.Face
+	coverfilename := filepath.Join(constant.Filepath, fmt.Sprintf("%s.jpeg", randomstring.GenerateRandomString(16)))
+	defer os.Remove(coverfilename)
+	coverresp, err := resty.New().R().
+		SetOutput(coverfilename).
+		Get(coverurl)
+	if err != nil {
+		end(err)
+		return fail(videoinfo.Title, fmt.Errorf("下载封面失败: %v", err))
+	}
+	if coverresp.StatusCode() != 200 {
+		err = fmt.Errorf("请求封面失败: status code %d", coverresp.StatusCode())
+		end(err)
+		return fail(videoinfo.Title, err)
+	}
+	end(nil)
+	audioreq.CoverArt = coverfilename
+
+	songId, err := TranslateVideoToAudio(audioreq, cookiefile, &item)
+	if err != nil {
+		return fail(videoinfo.Title, fmt.Errorf("上传失败: %v", err))
+	}
+	item.SongId = songId
+	if err := cloudnet.RecordUpload(uid, bvid, cloudnet.LedgerEntry{
+		SongId:     songId,
+		Title:      title,
+		UploadedAt: time.Now(),
+	}); err != nil {
+		log.Logger.Warn("fail to record upload", log.String("bvid", bvid), log.Any("err", err))
+	}
+
+	return result{Index: index, Title: title, SongId: songId, Err: nil, Item: item}
+}
+
+// addUploadedToPlaylist 按请求顺序批量把已上传的歌曲加入歌单，并逐首记录结果
+func addUploadedToPlaylist(taskID string, req VideoStreamReq, uploaded []result, cookiefile string) {
+	sort.Slice(uploaded, func(i, j int) bool { return uploaded[i].Index < uploaded[j].Index })
+	trackIds := make([]int64, 0, len(uploaded))
+	for _, r := range uploaded {
+		trackIds = append(trackIds, r.SongId)
+	}
+
+	start := time.Now()
+	failedTracks, reorderErr, err := cloudnet.AddTracksToPlaylist(cloudnet.AddTracksReq{
+		Pid:      req.Pid,
+		TrackIds: trackIds,
+		Position: req.Position,
+	}, cookiefile)
+	finish := time.Now()
+
+	successes := make([]string, 0, len(uploaded))
+	failures := make([]failed, 0)
+	for _, r := range uploaded {
+		addErr := err
+		if addErr == nil {
+			addErr = failedTracks[r.SongId]
+		}
+		stage := StageTiming{Stage: StagePlaylist, StartedAt: start, FinishedAt: finish}
+		if addErr != nil {
+			msg := fmt.Sprintf("已上传到云盘，但添加到歌单失败: %v", addErr)
+			stage.Error = addErr.Error()
+			r.Item.Stages = append(r.Item.Stages, stage)
+			r.Item.Status = constant.ItemStatusFailed
+			r.Item.Error = msg
+			taskManager.setResult(taskID, r.Item)
+			failures = append(failures, failed{
+				Title: r.Title,
+				Error: msg,
+			})
+			continue
+		}
+		// 已加入歌单但顺序未调整：仍算成功，在结果中注明
+		if reorderErr != nil {
+			stage.Error = reorderErr.Error()
+			r.Item.Error = fmt.Sprintf("已添加到歌单，但未能调整歌曲顺序: %v", reorderErr)
+		}
+		r.Item.Stages = append(r.Item.Stages, stage)
+		r.Item.Status = constant.ItemStatusSuccess
+		r.Item.Pid = req.Pid
+		taskManager.setResult(taskID, r.Item)
+		successes = append(successes, r.Title)
+	}
+	taskManager.settlePending(taskID, successes, failures)
 }
 
 // Task控制函数
 
 // 创建新任务
-func (tm *TaskManager) createTask(req VideoStreamReq) *LoadMP4Task {
+func (tm *TaskManager) createTask(req VideoStreamReq, owner int64) *LoadMP4Task {
 	tm.mutex.Lock()
 	defer tm.mutex.Unlock()
 
@@ -331,9 +562,11 @@ func (tm *TaskManager) createTask(req VideoStreamReq) *LoadMP4Task {
 		Total:     len(req.Bvid),
 		Success:   make([]string, 0),
 		Failed:    make([]failed, 0),
+		Results:   make([]TaskItemResult, len(req.Bvid)),
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 		Request:   req,
+		owner:     owner,
 	}
 
 	tm.tasks[task.ID] = task
@@ -371,8 +604,7 @@ func (tm *TaskManager) addSuccess(taskID string, title string) {
 
 	if task, exists := tm.tasks[taskID]; exists {
 		task.Success = append(task.Success, title)
-		task.Progress = (len(task.Success) + len(task.Failed)) * 100 / task.Total
-		task.UpdatedAt = time.Now()
+		task.refreshProgress()
 	}
 }
 
@@ -383,11 +615,83 @@ func (tm *TaskManager) addFailed(taskID string, failedItem failed) {
 
 	if task, exists := tm.tasks[taskID]; exists {
 		task.Failed = append(task.Failed, failedItem)
-		task.Progress = (len(task.Success) + len(task.Failed)) * 100 / task.Total
+		task.refreshProgress()
+	}
+}
+
+// 记录一首已上传、等待加入歌单的歌曲
+func (tm *TaskManager) addPending(taskID string) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	if task, exists := tm.tasks[taskID]; exists {
+		task.pending++
+		task.refreshProgress()
+	}
+}
+
+// 批量加入歌单结束后，一次性写入结果
+func (tm *TaskManager) settlePending(taskID string, successes []string, failures []failed) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	if task, exists := tm.tasks[taskID]; exists {
+		task.Success = append(task.Success, successes...)
+		task.Failed = append(task.Failed, failures...)
+		task.pending = 0
+		task.refreshProgress()
+	}
+}
+
+// 写入单个视频的处理结果
+func (tm *TaskManager) setResult(taskID string, item TaskItemResult) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	if task, exists := tm.tasks[taskID]; exists && item.Index >= 0 && item.Index < len(task.Results) {
+		task.Results[item.Index] = item
 		task.UpdatedAt = time.Now()
 	}
 }
 
+// 生成任务报告快照
+func (tm *TaskManager) snapshotReport(taskID string) (TaskReport, bool) {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+
+	task, exists := tm.tasks[taskID]
+	if !exists {
+		return TaskReport{}, false
+	}
+	items := make([]TaskItemResult, len(task.Results))
+	copy(items, task.Results)
+	for i := range items {
+		// 尚未处理完成的条目只保留 bvid
+		if items[i].Bvid == "" && i < len(task.Request.Bvid) {
+			items[i] = TaskItemResult{Index: i, Bvid: task.Request.Bvid[i], Status: task.Status}
+		}
+	}
+	return TaskReport{
+		TaskID:     task.ID,
+		Status:     task.Status,
+		CreatedAt:  task.CreatedAt,
+		FinishedAt: task.UpdatedAt,
+		Request:    task.Request,
+		Items:      items,
+		OwnerUid:   task.owner,
+	}, true
+}
+
+// refreshProgress 按已处理数量计算进度，调用方需持有锁
+func (task *LoadMP4Task) refreshProgress() {
+	task.Progress = (len(task.Success) + len(task.Failed) + task.pending) * 100 / task.Total
+	// 还有歌曲等待加入歌单时，不显示为 100%
+	if task.pending > 0 && task.Progress >= 100 {
+		task.Progress = 99
+	}
+	task.UpdatedAt = time.Now()
+}
+
 func (tm *TaskManager) cleanTask(taskID string) {
 	tm.mutex.Lock()
 	defer tm.mutex.Unlock()
@@ -0,0 +1,136 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bilibili
+
+import (
+	"context"
+	"sync"
+
+	"bvtc/cloudnet"
+	"bvtc/config"
+	"bvtc/log"
+
+	"github.com/CuteReimu/bilibili/v2"
+	"golang.org/x/sync/semaphore"
+)
+
+// 可选的 MP3 比特率（kbps）
+var allowedBitrates = map[int]bool{128: true, 192: true, 256: true, 320: true}
+
+// 封面（960x960 JPEG）和 ID3 标签的预估体积
+const coverOverheadBytes = 300 * 1024
+
+// PreflightReport 任务开始前的检查结果
+type PreflightReport struct {
+	Bitrate        int             `json:"bitrate"`        // 输出比特率（kbps）
+	CloudUsed      int64           `json:"cloudUsed"`      // 云盘已用空间（字节）
+	CloudMax       int64           `json:"cloudMax"`       // 云盘总空间（字节）
+	CloudAvailable int64           `json:"cloudAvailable"` // 云盘剩余空间（字节）
+	EstimatedTotal int64           `json:"estimatedTotal"` // 预计上传总大小（字节）
+	Fits           bool            `json:"fits"`           // 剩余空间是否足够
+	Duplicates     int             `json:"duplicates"`     // 已上传过的数量
+	Items          []PreflightItem `json:"items"`
+	Error          string          `json:"error,omitempty"` // 云盘容量获取失败等非致命错误
+}
+
+type PreflightItem struct {
+	Bvid          string `json:"bvid"`
+	Title         string `json:"title,omitempty"`
+	Duration      int    `json:"duration,omitempty"`      // 秒
+	EstimatedSize int64  `json:"estimatedSize,omitempty"` // 字节
+	Duplicate     bool   `json:"duplicate,omitempty"`     // 台账中已有上传记录
+	SongId        int64  `json:"songId,omitempty"`        // 已上传时对应的云盘歌曲ID
+	Error         string `json:"error,omitempty"`
+}
+
+// defaultBitrate 默认比特率取配置 music.bits，不在可选比特率内时使用 320
+func defaultBitrate() int {
+	if kbps := config.GetConfig().Music.Bits / 1000; allowedBitrates[kbps] {
+		return kbps
+	}
+	return 320
+}
+
+// estimateSize 按时长和比特率估算 MP3 体积
+func estimateSize(duration int, bitrate int) int64 {
+	return int64(duration)*int64(bitrate)*1000/8 + coverOverheadBytes
+}
+
+// runPreflight 在下载前检查云盘容量、预估输出大小并查询去重台账
+func runPreflight(cli *bilibili.Client, req VideoStreamReq, cookiefile string, uid int64) PreflightReport {
+	report := PreflightReport{
+		Bitrate: req.Bitrate,
+		Items:   make([]PreflightItem, len(req.Bvid)),
+	}
+
+	var wg sync.WaitGroup
+	sem := semaphore.NewWeighted(config.GetConfig().Music.Concurrency)
+	for i, bvid := range req.Bvid {
+		report.Items[i].Bvid = bvid
+		if err := sem.Acquire(context.Background(), 1); err != nil {
+			report.Items[i].Error = "semaphore acquire failed: " + err.Error()
+			continue
+		}
+		wg.Add(1)
+		go func(item *PreflightItem) {
+			defer wg.Done()
+			defer sem.Release(1)
+
+			videoinfo, err := cli.GetVideoInfo(bilibili.VideoParam{Bvid: item.Bvid})
+			if err != nil {
+				item.Error = "get video info fail: " + err.Error()
+				return
+			}
+			item.Title = videoinfo.Title
+			item.Duration = videoinfo.Duration
+			item.EstimatedSize = estimateSize(videoinfo.Duration, req.Bitrate)
+		}(&report.Items[i])
+	}
+	wg.Wait()
+
+	uploaded, err := cloudnet.LookupUploads(uid, req.Bvid)
+	if err != nil {
+		log.Logger.Warn("preflight ledger lookup failed", log.Any("err", err))
+	}
+	for i := range report.Items {
+		item := &report.Items[i]
+		if entry, ok := uploaded[item.Bvid]; ok {
+			item.Duplicate = true
+			item.SongId = entry.SongId
+			report.Duplicates++
+		}
+		report.EstimatedTotal += item.EstimatedSize
+	}
+
+	capacity, err := cloudnet.GetCloudCapacity(cookiefile)
+	if err != nil {
+		// 拿不到容量时不阻塞任务，只在报告中提示
+		log.Logger.Warn("preflight cloud capacity failed", log.Any("err", err))
+		report.Error = err.Error()
+		report.Fits = true
+		return report
+	}
+	report.CloudUsed = capacity.Used
+	report.CloudMax = capacity.Max
+	report.CloudAvailable = max(capacity.Max-capacity.Used, 0)
+	report.Fits = report.EstimatedTotal <= report.CloudAvailable
+	return report
+}
@@ -0,0 +1,260 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package bilibili
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bvtc/log"
+	"bvtc/response"
+	redis_pool "bvtc/tool/pool"
+	"bvtc/tool/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 任务处理阶段
+const (
+	StageInfo     = "info"     // 获取视频信息
+	StageStream   = "stream"   // 获取视频流地址
+	StageTitle    = "title"    // AI 生成标题
+	StageDownload = "download" // 下载视频
+	StageCover    = "cover"    // 下载封面
+	StageConvert  = "convert"  // ffmpeg 转换
+	StageUpload   = "upload"   // 上传云盘
+	StagePlaylist = "playlist" // 加入歌单
+)
+
+// 标题来源，AI 生成时为 aititle.MethodRule 或 aititle.MethodLLM
+const (
+	titleSourceOriginal = "original" // 视频原标题
+	titleSourceOverride = "override" // 请求中的 titleOverride 或 metadataOverride
+)
+
+var reportStages = []string{StageInfo, StageStream, StageTitle, StageDownload, StageCover, StageConvert, StageUpload, StagePlaylist}
+
+// 任务报告在 Redis 中的保留时间
+const taskReportTTL = 7 * 24 * time.Hour
+
+// TaskItemResult 单个视频的处理结果
+type TaskItemResult struct {
+	Index          int           `json:"index"`
+	Bvid           string        `json:"bvid"`
+	Cid            int           `json:"cid,omitempty"`
+	OriginalTitle  string        `json:"originalTitle,omitempty"`  // 视频原标题
+	Title          string        `json:"title,omitempty"`          // 最终写入的歌名
+	SuggestedTitle string        `json:"suggestedTitle,omitempty"` // AI 建议的标题
+	TitleSource    string        `json:"titleSource,omitempty"`    // 标题来源：original、override、rule 或 llm
+	Artist         string        `json:"artist,omitempty"`
+	Format         string        `json:"format"`
+	Bitrate        int           `json:"bitrate"`            // kbps
+	Size           int64         `json:"size,omitempty"`     // 输出文件大小（字节）
+	Duration       int           `json:"duration,omitempty"` // 秒
+	SongId         int64         `json:"songId,omitempty"`   // 网易云云盘歌曲ID
+	Pid            int64         `json:"pid,omitempty"`      // 加入的歌单ID
+	Status         string        `json:"status"`             // success / failed
+	Error          string        `json:"error,omitempty"`
+	Stages         []StageTiming `json:"stages"`
+}
+
+type StageTiming struct {
+	Stage      string    `json:"stage"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// TaskReport 任务完成后可下载的报告
+type TaskReport struct {
+	TaskID     string           `json:"taskId"`
+	Status     string           `json:"status"`
+	CreatedAt  time.Time        `json:"createdAt"`
+	FinishedAt time.Time        `json:"finishedAt"`
+	Request    VideoStreamReq   `json:"request"`
+	Items      []TaskItemResult `json:"items"`
+	OwnerUid   int64            `json:"ownerUid"` // 创建任务的网易云账号
+}
+
+// beginStage 记录阶段开始，返回的函数在阶段结束时调用；r 为 nil 时不记录
+func (r *TaskItemResult) beginStage(stage string) func(err error) {
+	if r == nil {
+		return func(error) {}
+	}
+	start := time.Now()
+	return func(err error) {
+		timing := StageTiming{Stage: stage, StartedAt: start, FinishedAt: time.Now()}
+		if err != nil {
+			timing.Error = err.Error()
+		}
+		r.Stages = append(r.Stages, timing)
+	}
+}
+
+func taskReportKey(taskID string) string {
+	return "task:report:" + taskID
+}
+
+// saveTaskReport 任务结束后持久化报告，任务从内存清理后仍可下载
+func saveTaskReport(report TaskReport) error {
+	rdb := redis_pool.GetRdb()
+	if rdb == nil {
+		return fmt.Errorf("redis client is nil")
+	}
+	b, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	return rdb.Set(redis_pool.GetRctx(), taskReportKey(report.TaskID), b, taskReportTTL).Err()
+}
+
+func loadTaskReport(taskID string) (*TaskReport, error) {
+	rdb := redis_pool.GetRdb()
+	if rdb == nil {
+		return nil, fmt.Errorf("redis client is nil")
+	}
+	raw, err := rdb.Get(redis_pool.GetRctx(), taskReportKey(taskID)).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	var report TaskReport
+	if err := json.Unmarshal(raw, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// DownloadTaskReport 下载任务报告，format=json（默认）或 csv
+func DownloadTaskReport(ctx *gin.Context) {
+	taskID := ctx.Param("taskId")
+	if taskID == "" {
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("task_id is required"))
+		return
+	}
+
+	sid, err := ctx.Cookie("SessionId")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to get sessionId"))
+		return
+	}
+
+	var report *TaskReport
+	if r, ok := taskManager.snapshotReport(taskID); ok {
+		report = &r
+	} else {
+		r, err := loadTaskReport(taskID)
+		if err != nil {
+			log.Logger.Info("task report not found", log.String("taskId", taskID), log.Any("err", err))
+			ctx.JSON(http.StatusNotFound, response.FailMsg("task report not found"))
+			return
+		}
+		report = r
+	}
+	// 不属于当前账号的报告按不存在处理，避免泄露任务是否存在
+	if !ownsTask(sid, report.OwnerUid) {
+		log.Logger.Info("task report owner mismatch", log.String("taskId", taskID))
+		ctx.JSON(http.StatusNotFound, response.FailMsg("task report not found"))
+		return
+	}
+
+	switch ctx.DefaultQuery("format", "json") {
+	case "json":
+		ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="bvtc-task-%s.json"`, taskID))
+		ctx.JSON(http.StatusOK, report)
+	case "csv":
+		ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="bvtc-task-%s.csv"`, taskID))
+		ctx.Header("Content-Type", "text/csv; charset=utf-8")
+		ctx.Status(http.StatusOK)
+		// 写入 BOM，方便 Excel 正确识别中文
+		_, _ = ctx.Writer.Write([]byte("\xEF\xBB\xBF"))
+		if err := writeReportCSV(ctx.Writer, report); err != nil {
+			log.Logger.Error("fail to write csv report", log.Any("err", err))
+		}
+	default:
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("format must be json or csv"))
+	}
+}
+
+// ownsTask 任务是否由会话当前账号或会话关联的账号创建，旧报告没有记录创建者时一律拒绝
+func ownsTask(sid string, owner int64) bool {
+	if owner == 0 {
+		return false
+	}
+	if session.ActiveUid(sid) == owner {
+		return true
+	}
+	_, err := session.GetAccount(sid, owner)
+	return err == nil
+}
+
+func writeReportCSV(w http.ResponseWriter, report *TaskReport) error {
+	cw := csv.NewWriter(w)
+	header := []string{"index", "bvid", "cid", "original_title", "title", "suggested_title", "title_source", "artist", "format", "bitrate",
+		"size", "duration", "song_id", "pid", "status", "error"}
+	for _, stage := range reportStages {
+		header = append(header, stage+"_started_at", stage+"_finished_at")
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, item := range report.Items {
+		row := []string{
+			strconv.Itoa(item.Index),
+			item.Bvid,
+			strconv.Itoa(item.Cid),
+			item.OriginalTitle,
+			item.Title,
+			item.SuggestedTitle,
+			item.TitleSource,
+			item.Artist,
+			item.Format,
+			strconv.Itoa(item.Bitrate),
+			strconv.FormatInt(item.Size, 10),
+			strconv.Itoa(item.Duration),
+			strconv.FormatInt(item.SongId, 10),
+			strconv.FormatInt(item.Pid, 10),
+			item.Status,
+			item.Error,
+		}
+		timings := make(map[string]StageTiming, len(item.Stages))
+		for _, t := range item.Stages {
+			timings[t.Stage] = t
+		}
+		for _, stage := range reportStages {
+			t, ok := timings[stage]
+			if !ok {
+				row = append(row, "", "")
+				continue
+			}
+			row = append(row, t.StartedAt.Format(time.RFC3339Nano), t.FinishedAt.Format(time.RFC3339Nano))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -37,23 +37,27 @@ import (
 )
 
 type AudioReq struct {
-	Filename string
-	Artist   string
-	Title    string
-	CoverArt string
+	Filename       string
+	Artist         string
+	OriginalArtist string // 原唱，翻唱时写入
+	Title          string
+	CoverArt       string
+	Bitrate        int // kbps，0 时使用 320
 }
 
-func TranslateVideoToAudio(req AudioReq, splaylist bool, pid int64, cookiefile string) error {
+// TranslateVideoToAudio 提取音频并上传到网易云云盘，返回云盘歌曲ID
+// item 不为空时记录转换、上传阶段耗时与输出文件大小
+func TranslateVideoToAudio(req AudioReq, cookiefile string, item *TaskItemResult) (int64, error) {
 	currentDir, err := os.Getwd()
 	if err != nil {
 		log.Logger.Error("获取当前目录失败", log.Any("err", err))
-		return errors.New("获取当前目录失败")
+		return 0, errors.New("获取当前目录失败")
 	}
 	inputFile := filepath.Join(currentDir, req.Filename)
 
 	if _, err = os.Stat(inputFile); os.IsNotExist(err) {
 		log.Logger.Error("输入文件不存在", log.Any("file", inputFile))
-		return errors.New("输入文件不存在")
+		return 0, errors.New("输入文件不存在")
 	}
 
 	outputFile := strings.TrimSuffix(req.Filename, ".mp4") + ".mp3"
@@ -62,22 +66,40 @@ func TranslateVideoToAudio(req AudioReq, splaylist bool, pid int64, cookiefile s
 	ffmpegPath, err := ffmpeg.ExtractFFmpeg()
 	if err != nil {
 		log.Logger.Error("FFmpeg 初始化失败", log.Any("err", err))
-		return errors.New("FFmpeg 初始化失败")
+		return 0, errors.New("FFmpeg 初始化失败")
 	}
 	defer os.Remove(ffmpegPath)
 
 	// 执行转换
+	endConvert := item.beginStage(StageConvert)
 	if err := convertToMP3(ffmpegPath, inputFile, outputFile, req); err != nil {
-		return errors.New("转换失败")
+		endConvert(err)
+		return 0, errors.New("转换失败")
+	}
+	endConvert(nil)
+	if item != nil {
+		if info, err := os.Stat(outputFile); err == nil {
+			item.Size = info.Size()
+		}
 	}
 
-	err = cloudnet.UploadToNetCloud(outputFile, splaylist, pid,cookiefile)
+	endUpload := item.beginStage(StageUpload)
+	songId, err := cloudnet.UploadToNetCloud(outputFile, req.Title, cookiefile, req.outputBitrate())
+	endUpload(err)
 	if err != nil {
 		log.Logger.Error("上传失败", log.Any("req", req), log.Any("err", err))
-		return err
+		return 0, err
 	}
 
-	return nil
+	return songId, nil
+}
+
+// outputBitrate 输出比特率（kbps），未指定时使用 320
+func (req AudioReq) outputBitrate() int {
+	if req.Bitrate <= 0 {
+		return 320
+	}
+	return req.Bitrate
 }
 
 // 这个封面有时候不能用？不知道是什么逻辑
@@ -88,6 +110,8 @@ func convertToMP3(ffmpegPath, inputFile, outputFile string, req AudioReq) error
 		return err
 	}
 
+	bitrate := req.outputBitrate()
+
 	// 生成暂时文件存储纯音频数据，防止并行时瞎缝
 	tmpOutput := filepath.Join(constant.Filepath, fmt.Sprintf("%s.mp3", randomstring.GenerateRandomString(16)))
 	defer os.Remove(tmpOutput) // 恢复临时文件清理
@@ -98,7 +122,7 @@ func convertToMP3(ffmpegPath, inputFile, outputFile string, req AudioReq) error
 		"-vn",                 // 禁用视频流
 		"-map_metadata", "-1", // 清除所有元数据
 		"-acodec", "libmp3lame", // 	音频编码(LAME3.101(bate3)) ? 网易云MP3保存部分此处为乱码,flac用	libFLAC 1.3.2 (2017-01-01)
-		"-b:a", "320k", //	比特率
+		"-b:a", fmt.Sprintf("%dk", bitrate), //	比特率
 		"-y", // 覆盖输出文件
 		tmpOutput,
 	)
@@ -127,6 +151,7 @@ func convertToMP3(ffmpegPath, inputFile, outputFile string, req AudioReq) error
 		"-id3v2_version", "3", // 采用ID3V2.3版本
 		"-metadata", "title="+req.Title, // 标题
 		"-metadata", "artist="+req.Artist, // 歌手
+		"-metadata", "original_artist="+req.OriginalArtist, // 原唱(为空时不写入)
 		"-metadata", "album=", // 专辑(留空)
 		"-metadata:s:v", "title=Cover",
 		"-metadata:s:v", "comment=Cover (Front)",
@@ -33,6 +33,7 @@ import (
 	"path/filepath"
 
 	"bvtc/config"
+	"bvtc/tool/credential"
 
 	"github.com/CuteReimu/bilibili/v2"
 	"github.com/chaunsin/netease-cloud-music/api"
@@ -133,7 +134,12 @@ func MultiInitNetcloudCli(cookieFile string) (*weapi.Api, *api.Client, error) {
 	if cookieFile == "" {
 		userCookieFile = filepath.Join(filepath.Clean(cfg.Api.Cookie.Filepath), "cookie.json")
 	} else {
-		userCookieFile = filepath.Join(filepath.Clean(cfg.Api.Cookie.Filepath), cookieFile)
+		// 用户 cookie 从凭据存储解密到运行时文件，客户端关闭时再加密写回
+		path, err := credential.Materialize(cookieFile)
+		if err != nil {
+			return netcApi, netcCli, err
+		}
+		userCookieFile = path
 	}
 	// 检查 cookie 文件是否存在，如果不存在则创建
 	if _, err := os.Stat(userCookieFile); os.IsNotExist(err) {
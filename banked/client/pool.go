@@ -0,0 +1,261 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"bvtc/config"
+	"bvtc/log"
+	"bvtc/tool/credential"
+
+	"github.com/chaunsin/netease-cloud-music/api"
+	"github.com/chaunsin/netease-cloud-music/api/weapi"
+)
+
+const (
+	defaultPoolIdleTimeout = 10 * time.Minute
+	poolSweepInterval      = time.Minute
+)
+
+// netcloudEntry 同一个 cookie 文件共享的已认证客户端
+type netcloudEntry struct {
+	api      *weapi.Api
+	cli      *api.Client
+	refs     int       // 正在使用的数量
+	lastUsed time.Time // 最近一次归还时间
+	invalid  bool      // 已失效，归还后立即关闭
+	purge    bool      // 关闭后删除 cookie 文件（退出登录）
+
+	ready chan struct{} // 初始化完成后关闭，之后 api、cli、err 只读
+	err   error         // 初始化失败的原因
+}
+
+// netcloudPool 按 cookie 文件缓存网易云客户端，引用计数 + 空闲淘汰
+type netcloudPool struct {
+	mu      sync.Mutex
+	entries map[string]*netcloudEntry
+
+	startOnce sync.Once
+	done      chan struct{}
+}
+
+var netcPool = &netcloudPool{
+	entries: make(map[string]*netcloudEntry),
+	done:    make(chan struct{}),
+}
+
+// AcquireNetcloudApi 获取 cookieFile 对应的共享客户端，并发安全。
+// 使用完毕后必须调用 release 归还，归还后客户端可能被淘汰关闭。
+// 客户端初始化（读取、解密凭据）在锁外进行，同一个 cookie 文件只初始化一次，其余调用者等待结果
+func AcquireNetcloudApi(cookieFile string) (netcApi *weapi.Api, release func(), err error) {
+	netcPool.startOnce.Do(func() {
+		go netcPool.sweep()
+	})
+
+	netcPool.mu.Lock()
+	entry, ok := netcPool.entries[cookieFile]
+	if !ok || entry.invalid {
+		// 先放入占位，已失效但仍被占用的旧客户端由最后一个使用者归还时关闭
+		entry = &netcloudEntry{ready: make(chan struct{})}
+		netcPool.entries[cookieFile] = entry
+		entry.refs++
+		netcPool.mu.Unlock()
+
+		netcPool.init(cookieFile, entry)
+	} else {
+		entry.refs++
+		netcPool.mu.Unlock()
+	}
+
+	<-entry.ready
+	if entry.err != nil {
+		netcPool.release(cookieFile, entry)
+		return nil, nil, entry.err
+	}
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			netcPool.release(cookieFile, entry)
+		})
+	}
+	return entry.api, release, nil
+}
+
+// init 初始化占位的客户端，失败时从池中移除，等待者各自归还引用
+func (p *netcloudPool) init(cookieFile string, entry *netcloudEntry) {
+	netcApi, cli, err := MultiInitNetcloudCli(cookieFile)
+
+	p.mu.Lock()
+	entry.api, entry.cli, entry.err = netcApi, cli, err
+	if err != nil {
+		entry.invalid = true
+		if p.entries[cookieFile] == entry {
+			delete(p.entries, cookieFile)
+		}
+	}
+	close(entry.ready)
+	p.mu.Unlock()
+}
+
+func (p *netcloudPool) release(cookieFile string, entry *netcloudEntry) {
+	p.mu.Lock()
+	entry.refs--
+	entry.lastUsed = time.Now()
+	closeNow := entry.invalid && entry.refs <= 0
+	if closeNow && p.entries[cookieFile] == entry {
+		delete(p.entries, cookieFile)
+	}
+	p.mu.Unlock()
+
+	if closeNow {
+		closeEntry(cookieFile, entry)
+	}
+}
+
+// InvalidateNetcloudCli 使客户端失效：关闭后 cookie 会落盘，下次获取时重新加载。
+// 正在使用中的客户端会在最后一个使用者归还后关闭。
+func InvalidateNetcloudCli(cookieFile string) {
+	netcPool.invalidate(cookieFile, false)
+}
+
+// PurgeNetcloudCli 退出登录时调用：关闭客户端并删除凭据
+func PurgeNetcloudCli(cookieFile string) {
+	if !netcPool.invalidate(cookieFile, true) {
+		// 池中没有该客户端，直接删除凭据
+		removeCookieFile(cookieFile)
+	}
+}
+
+// invalidate 返回池中是否存在该客户端
+func (p *netcloudPool) invalidate(cookieFile string, purge bool) bool {
+	p.mu.Lock()
+	entry, ok := p.entries[cookieFile]
+	if !ok {
+		p.mu.Unlock()
+		return false
+	}
+	entry.invalid = true
+	entry.purge = entry.purge || purge
+	closeNow := entry.refs <= 0
+	if closeNow {
+		delete(p.entries, cookieFile)
+	}
+	p.mu.Unlock()
+
+	if closeNow {
+		closeEntry(cookieFile, entry)
+	}
+	return true
+}
+
+// sweep 定期关闭空闲超时的客户端
+func (p *netcloudPool) sweep() {
+	ticker := time.NewTicker(poolSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			idle := config.GetConfig().Api.Pool.IdleTimeout
+			if idle <= 0 {
+				idle = defaultPoolIdleTimeout
+			}
+
+			expired := make(map[string]*netcloudEntry)
+			p.mu.Lock()
+			for cookieFile, entry := range p.entries {
+				if entry.refs <= 0 && time.Since(entry.lastUsed) > idle {
+					expired[cookieFile] = entry
+					delete(p.entries, cookieFile)
+				}
+			}
+			p.mu.Unlock()
+
+			for cookieFile, entry := range expired {
+				closeEntry(cookieFile, entry)
+			}
+		}
+	}
+}
+
+// ShutdownNetcloudPool 程序退出时关闭所有客户端，保证 cookie 落盘
+func ShutdownNetcloudPool(ctx context.Context) error {
+	netcPool.mu.Lock()
+	select {
+	case <-netcPool.done:
+	default:
+		close(netcPool.done)
+	}
+	entries := netcPool.entries
+	netcPool.entries = make(map[string]*netcloudEntry)
+	netcPool.mu.Unlock()
+
+	for cookieFile, entry := range entries {
+		closeEntry(cookieFile, entry)
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		return nil
+	}
+}
+
+func closeEntry(cookieFile string, entry *netcloudEntry) {
+	<-entry.ready
+	if entry.err != nil {
+		// 初始化失败，没有客户端需要关闭
+		if entry.purge {
+			removeCookieFile(cookieFile)
+		}
+		return
+	}
+	if err := entry.cli.Close(context.Background()); err != nil {
+		log.Logger.Error("close netcloud client failed", log.String("cookieFile", cookieFile), log.Any("err", err))
+	}
+	if cookieFile == "" {
+		return
+	}
+	if entry.purge {
+		removeCookieFile(cookieFile)
+		return
+	}
+	// 客户端关闭时 cookie 已写入运行时文件，加密写回凭据存储
+	if err := credential.Seal(cookieFile); err != nil {
+		log.Logger.Error("failed to seal credential", log.String("cookieFile", cookieFile), log.Any("err", err))
+	}
+}
+
+func removeCookieFile(cookieFile string) {
+	if cookieFile == "" {
+		return
+	}
+	if err := credential.Delete(cookieFile); err != nil {
+		log.Logger.Error("failed to remove credential", log.String("cookieFile", cookieFile), log.Any("err", err))
+	}
+}
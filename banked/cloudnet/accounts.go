@@ -0,0 +1,304 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cloudnet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"bvtc/client"
+	"bvtc/log"
+	"bvtc/response"
+	"bvtc/tool/session"
+
+	"github.com/chaunsin/netease-cloud-music/api/weapi"
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+)
+
+type AccountItem struct {
+	Uid       int64     `json:"uid"`
+	Nickname  string    `json:"nickname"`
+	AvatarUrl string    `json:"avatarUrl"`
+	Active    bool      `json:"active"`      // 是否为当前使用的账号
+	Relogin   bool      `json:"needRelogin"` // 登录已失效，需要重新登录
+	LinkedAt  time.Time `json:"linkedAt"`
+}
+
+type AccountReq struct {
+	Uid int64 `json:"uid"`
+}
+
+// ListAccounts 列出会话中关联的网易云账号
+func ListAccounts(ctx *gin.Context) {
+	sid, err := ctx.Cookie("SessionId")
+	if err != nil {
+		log.Logger.Error("fail to get sessionId", log.Any("err : ", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to get sessionId"))
+		return
+	}
+
+	accounts, err := session.ListAccounts(sid)
+	if err != nil {
+		log.Logger.Error("fail to list accounts", log.Any("err", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to list accounts"))
+		return
+	}
+	// 旧会话没有账号列表，把当前登录的账号补进去
+	if len(accounts) == 0 {
+		acc, err := backfillActiveAccount(ctx, sid)
+		if err != nil {
+			log.Logger.Error("fail to backfill account", log.Any("err", err))
+			ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to get account"))
+			return
+		}
+		accounts = append(accounts, acc)
+	}
+
+	activeUid := activeAccountUid(sid)
+	items := make([]AccountItem, 0, len(accounts))
+	for _, acc := range accounts {
+		items = append(items, AccountItem{
+			Uid:       acc.Uid,
+			Nickname:  acc.Nickname,
+			AvatarUrl: acc.AvatarUrl,
+			Active:    acc.Uid == activeUid,
+			Relogin:   session.CredentialExpired(acc.CookieFile),
+			LinkedAt:  acc.LinkedAt,
+		})
+	}
+	ctx.JSON(http.StatusOK, response.SuccessMsg(items))
+}
+
+// SelectAccount 切换当前使用的账号，歌单、上传等操作默认作用于当前账号
+func SelectAccount(ctx *gin.Context) {
+	sid, err := ctx.Cookie("SessionId")
+	if err != nil {
+		log.Logger.Error("fail to get sessionId", log.Any("err : ", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to get sessionId"))
+		return
+	}
+	var req AccountReq
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.Uid == 0 {
+		log.Logger.Error("invalid select account request", log.Any("err", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("uid is required"))
+		return
+	}
+
+	acc, err := session.GetAccount(sid, req.Uid)
+	if errors.Is(err, session.ErrAccountNotLinked) {
+		ctx.JSON(http.StatusNotFound, response.FailMsg("account not linked"))
+		return
+	}
+	if err != nil {
+		log.Logger.Error("fail to get account", log.Any("err", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to get account"))
+		return
+	}
+	if err := session.SetActiveAccount(sid, *acc); err != nil {
+		log.Logger.Error("fail to set active account", log.Any("err", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to set active account"))
+		return
+	}
+
+	log.Logger.Info("active account switched", log.String("sid", sid), log.Any("uid", acc.Uid))
+	ctx.JSON(http.StatusOK, response.SuccessMsg(""))
+}
+
+// RemoveAccount 取消关联账号并删除其 cookie，最后一个账号需要通过退出登录移除
+func RemoveAccount(ctx *gin.Context) {
+	sid, err := ctx.Cookie("SessionId")
+	if err != nil {
+		log.Logger.Error("fail to get sessionId", log.Any("err : ", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to get sessionId"))
+		return
+	}
+	var req AccountReq
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.Uid == 0 {
+		log.Logger.Error("invalid remove account request", log.Any("err", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("uid is required"))
+		return
+	}
+
+	accounts, err := session.ListAccounts(sid)
+	if err != nil {
+		log.Logger.Error("fail to list accounts", log.Any("err", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to list accounts"))
+		return
+	}
+	var target *session.LinkedAccount
+	var remaining []session.LinkedAccount
+	for i := range accounts {
+		if accounts[i].Uid == req.Uid {
+			target = &accounts[i]
+			continue
+		}
+		remaining = append(remaining, accounts[i])
+	}
+	if target == nil {
+		ctx.JSON(http.StatusNotFound, response.FailMsg("account not linked"))
+		return
+	}
+	if len(remaining) == 0 {
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("cannot remove the last account, please logout instead"))
+		return
+	}
+
+	// 移除的是当前账号时，切换到最早关联的其他账号
+	if activeAccountUid(sid) == target.Uid {
+		if err := session.SetActiveAccount(sid, remaining[0]); err != nil {
+			log.Logger.Error("fail to set active account", log.Any("err", err))
+			ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to set active account"))
+			return
+		}
+	}
+	if err := session.RemoveAccount(sid, target.Uid); err != nil {
+		log.Logger.Error("fail to remove account", log.Any("err", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to remove account"))
+		return
+	}
+	client.PurgeNetcloudCli(target.CookieFile)
+
+	log.Logger.Info("account removed", log.String("sid", sid), log.Any("uid", target.Uid))
+	ctx.JSON(http.StatusOK, response.SuccessMsg(""))
+}
+
+// GetLinkAccountQrcode 生成关联新账号的二维码，新账号使用独立的 cookie 文件
+func GetLinkAccountQrcode(ctx *gin.Context) {
+	sid, err := ctx.Cookie("SessionId")
+	if err != nil {
+		log.Logger.Error("fail to get sessionId", log.Any("err : ", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to get sessionId"))
+		return
+	}
+
+	cookieFile := filepath.Join(session.GenerateSessionID(32) + ".json")
+	api, release, err := client.AcquireNetcloudApi(cookieFile)
+	if err != nil {
+		log.Logger.Error("client fail to init", log.Any("err : ", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("client fail to init"))
+		return
+	}
+	defer release()
+
+	qrKey, err := api.QrcodeCreateKey(ctx, &weapi.QrcodeCreateKeyReq{Type: 1})
+	if err != nil || qrKey.UniKey == "" {
+		log.Logger.Error("fail to create qrcode key", log.Any("err : ", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to create qrcode key"))
+		return
+	}
+	qr, err := api.QrcodeGenerate(ctx, &weapi.QrcodeGenerateReq{CodeKey: qrKey.UniKey, Level: qrcode.Medium, Platform: "web"})
+	if err != nil {
+		log.Logger.Error("fail to create qrcode", log.Any("err : ", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to create qrcode"))
+		return
+	}
+
+	if err := session.SetPendingLink(sid, cookieFile, qrKey.UniKey); err != nil {
+		log.Logger.Error("redis fail to set", log.Any("err : ", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("redis fail to set"))
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-cache, no-store")
+	ctx.Data(http.StatusOK, "image/png", bytes.NewBuffer(qr.Qrcode).Bytes())
+}
+
+// CheckLinkAccountQrcode 推送关联账号的扫码状态，支持 websocket、SSE 和长轮询
+func CheckLinkAccountQrcode(ctx *gin.Context) {
+	sid, err := ctx.Cookie("SessionId")
+	if err != nil {
+		log.Logger.Error("fail to get sessionId", log.Any("err : ", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to get sessionId"))
+		return
+	}
+	cookieFile, unikey, err := session.GetPendingLink(sid)
+	if err != nil {
+		log.Logger.Error("pending link not found", log.Any("err : ", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("unikey not found"))
+		return
+	}
+
+	serveQrcodeStatus(ctx, &qrcodeWatch{
+		id:         "link:" + sid + ":" + unikey,
+		sid:        sid,
+		cookieFile: cookieFile,
+		unikey:     unikey,
+		successMsg: "success to link account",
+		confirm: func(c context.Context, api *weapi.Api) (any, error) {
+			user, err := api.GetUserInfo(c, &weapi.GetUserInfoReq{})
+			if err != nil {
+				return nil, errors.New("获取用户信息失败")
+			}
+			client.InvalidateNetcloudCli(cookieFile)
+			acc, err := linkAccount(sid, cookieFile, user)
+			if err != nil {
+				return nil, err
+			}
+			return AccountItem{
+				Uid:       acc.Uid,
+				Nickname:  acc.Nickname,
+				AvatarUrl: acc.AvatarUrl,
+				Active:    activeAccountUid(sid) == acc.Uid,
+				LinkedAt:  acc.LinkedAt,
+			}, nil
+		},
+		cleanup: func(success bool) {
+			_ = session.DelPendingLink(sid, unikey)
+			if !success {
+				// 未完成关联的 cookie 文件没有用处，直接清理
+				client.PurgeNetcloudCli(cookieFile)
+			}
+		},
+	})
+}
+
+// activeAccountUid 会话当前使用的账号ID，旧会话没有该字段时返回 0
+func activeAccountUid(sid string) int64 {
+	return session.ActiveUid(sid)
+}
+
+// backfillActiveAccount 把旧会话中唯一的 cookie 文件登记为关联账号
+func backfillActiveAccount(ctx context.Context, sid string) (session.LinkedAccount, error) {
+	cookieFile := session.GetCookieBySession(sid)
+	if cookieFile == "" {
+		return session.LinkedAccount{}, errors.New("session not found or expired")
+	}
+	api, release, err := client.AcquireNetcloudApi(cookieFile)
+	if err != nil {
+		return session.LinkedAccount{}, err
+	}
+	defer release()
+
+	user, err := api.GetUserInfo(ctx, &weapi.GetUserInfoReq{})
+	if err != nil {
+		return session.LinkedAccount{}, err
+	}
+	acc, err := linkAccount(sid, cookieFile, user)
+	if err != nil {
+		return acc, err
+	}
+	return acc, session.SetActiveAccount(sid, acc)
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cloudnet
+
+import (
+	"context"
+	"time"
+
+	"bvtc/client"
+	"bvtc/config"
+	"bvtc/log"
+	"bvtc/tool/credential"
+	"bvtc/tool/session"
+
+	"github.com/chaunsin/netease-cloud-music/api/weapi"
+)
+
+// 默认凭据健康检查间隔
+const defaultHealthCheckInterval = 30 * time.Minute
+
+// StartCredentialHealthCheck 定期检查所有会话的网易云凭据，失效时标记并暂停对应账号的任务，ctx 结束后退出
+func StartCredentialHealthCheck(ctx context.Context) {
+	interval := config.GetConfig().Api.Health.Interval
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkCredentials(ctx)
+		}
+	}
+}
+
+// checkCredentials 检查一轮所有会话中关联的凭据，同一凭据只检查一次
+func checkCredentials(ctx context.Context) {
+	sids, err := session.ActiveSessions()
+	if err != nil {
+		log.Logger.Error("fail to list sessions", log.Any("err", err))
+		return
+	}
+
+	// cookieFile -> uid
+	credentials := make(map[string]int64)
+	for _, sid := range sids {
+		accounts, err := session.ListAccounts(sid)
+		if err != nil {
+			log.Logger.Warn("fail to list accounts", log.String("sid", sid), log.Any("err", err))
+			continue
+		}
+		for _, acc := range accounts {
+			credentials[acc.CookieFile] = acc.Uid
+		}
+		// 还未回填关联账号的旧会话，以及个人访问令牌的会话
+		cookieFile := session.GetCookieBySession(sid)
+		if _, ok := credentials[cookieFile]; cookieFile == "" || ok {
+			continue
+		}
+		// 令牌使用的是凭据副本，失效时只让该令牌返回 401，不暂停整个账号
+		if session.IsTokenSession(sid) {
+			credentials[cookieFile] = 0
+			continue
+		}
+		// 没有绑定账号的会话可能是还在扫码或短信验证中的登录，凭据尚未生效，不检查
+		if uid := activeAccountUid(sid); uid != 0 {
+			credentials[cookieFile] = uid
+		}
+	}
+
+	var checked, expired int
+	// 本轮检查有效的账号：同一账号在其他会话中的凭据失效不影响这些账号创建任务
+	healthy := make(map[int64]bool)
+	for cookieFile, uid := range credentials {
+		if ctx.Err() != nil {
+			return
+		}
+		if session.CredentialExpired(cookieFile) || !credential.Exists(cookieFile) {
+			continue
+		}
+		checked++
+		if checkCredential(ctx, cookieFile) {
+			healthy[uid] = true
+			continue
+		}
+		expired++
+		log.Logger.Info("netcloud credential expired", log.String("cookieFile", cookieFile), log.Any("uid", uid))
+		if err := session.MarkCredentialExpired(cookieFile, uid); err != nil {
+			log.Logger.Error("fail to mark credential expired", log.String("cookieFile", cookieFile), log.Any("err", err))
+		}
+		client.InvalidateNetcloudCli(cookieFile)
+	}
+
+	for uid := range healthy {
+		if uid == 0 || !session.AccountJobsPaused(uid) {
+			continue
+		}
+		if err := session.ResumeAccountJobs(uid); err != nil {
+			log.Logger.Warn("fail to resume account jobs", log.Any("uid", uid), log.Any("err", err))
+			continue
+		}
+		log.Logger.Info("account jobs resumed, credential still valid", log.Any("uid", uid))
+	}
+
+	// 凭据已被删除的失效标记没有意义，顺便清理
+	marked, err := session.ExpiredCredentials()
+	if err == nil {
+		for _, cookieFile := range marked {
+			if !credential.Exists(cookieFile) {
+				_ = session.ClearCredentialExpired(cookieFile)
+			}
+		}
+	}
+	log.Logger.Info("credential health check finished", log.Int("checked", checked), log.Int("expired", expired))
+}
+
+// checkCredential 凭据仍然有效时尝试刷新登录 token，返回凭据是否有效
+func checkCredential(ctx context.Context, cookieFile string) bool {
+	api, release, err := client.AcquireNetcloudApi(cookieFile)
+	if err != nil {
+		// 客户端初始化失败不代表登录失效，下一轮再检查
+		log.Logger.Warn("client fail to init", log.String("cookieFile", cookieFile), log.Any("err", err))
+		return true
+	}
+	defer release()
+
+	checkCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if api.NeedLogin(checkCtx) {
+		return false
+	}
+	resp, err := api.TokenRefresh(checkCtx, &weapi.TokenRefreshReq{})
+	if err != nil {
+		log.Logger.Warn("fail to refresh token", log.String("cookieFile", cookieFile), log.Any("err", err))
+	} else if resp != nil && resp.Code != 200 {
+		log.Logger.Warn("fail to refresh token", log.String("cookieFile", cookieFile), log.Any("code", resp.Code))
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cloudnet
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	redis_pool "bvtc/tool/pool"
+)
+
+// 去重台账：记录每个网易云账号已经从哪些 bvid 上传过歌曲
+// Redis hash  ledger:<uid>  field 为 bvid，value 为 LedgerEntry 的 JSON
+
+type LedgerEntry struct {
+	SongId     int64     `json:"songId"`
+	Title      string    `json:"title"`
+	UploadedAt time.Time `json:"uploadedAt"`
+}
+
+func ledgerKey(uid int64) string {
+	return "ledger:" + strconv.FormatInt(uid, 10)
+}
+
+// RecordUpload 上传成功后写入台账
+func RecordUpload(uid int64, bvid string, entry LedgerEntry) error {
+	if uid == 0 || bvid == "" {
+		return fmt.Errorf("uid or bvid is empty")
+	}
+	rdb := redis_pool.GetRdb()
+	if rdb == nil {
+		return fmt.Errorf("redis client is nil")
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := rdb.HSet(redis_pool.GetRctx(), ledgerKey(uid), bvid, b).Err(); err != nil {
+		return fmt.Errorf("redis HSet failed: %w", err)
+	}
+	return nil
+}
+
+// LookupUploads 查询 bvids 中已经上传过的记录
+func LookupUploads(uid int64, bvids []string) (map[string]LedgerEntry, error) {
+	found := make(map[string]LedgerEntry)
+	if uid == 0 || len(bvids) == 0 {
+		return found, nil
+	}
+	rdb := redis_pool.GetRdb()
+	if rdb == nil {
+		return nil, fmt.Errorf("redis client is nil")
+	}
+	values, err := rdb.HMGet(redis_pool.GetRctx(), ledgerKey(uid), bvids...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis HMGet failed: %w", err)
+	}
+	for i, v := range values {
+		raw, ok := v.(string)
+		if !ok || raw == "" {
+			continue
+		}
+		var entry LedgerEntry
+		if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+			continue
+		}
+		found[bvids[i]] = entry
+	}
+	return found, nil
+}
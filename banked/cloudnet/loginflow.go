@@ -0,0 +1,179 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cloudnet
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"bvtc/client"
+	"bvtc/log"
+	"bvtc/response"
+	redis_pool "bvtc/tool/pool"
+	"bvtc/tool/session"
+
+	"github.com/chaunsin/netease-cloud-music/api/weapi"
+	"github.com/gin-gonic/gin"
+)
+
+// 网易云登录接口的返回码
+const (
+	codeLoginSuccess    = 200
+	codeAccountNotExist = 501  // 账号不存在
+	codeWrongPassword   = 502  // 密码错误
+	codeTooManyAttempts = 509  // 密码错误次数过多
+	codeNeedBehavior    = 8821 // 需要行为验证码验证，网页端无法完成
+	codeSecurityCheck   = -462 // 触发安全验证，需要打开链接验证
+)
+
+// 需要用户额外操作时返回给前端的验证类型
+const (
+	VerifyTypeSms   = "sms"   // 改用短信验证码登录
+	VerifyTypeUrl   = "url"   // 打开链接完成安全验证后重试
+	VerifyTypeRetry = "retry" // 稍后再试
+)
+
+// LoginVerifyStep 登录被风控拦截时，告诉前端下一步该做什么
+type LoginVerifyStep struct {
+	Type    string `json:"type"`
+	Url     string `json:"url,omitempty"`
+	Message string `json:"message"`
+}
+
+// detectRiskControl 根据网易云返回码判断是否被风控，返回 nil 表示不是风控
+func detectRiskControl(code int64, data any) *LoginVerifyStep {
+	switch code {
+	case codeNeedBehavior:
+		return &LoginVerifyStep{Type: VerifyTypeSms, Message: "当前登录方式触发网易云风控，请改用短信验证码或二维码登录"}
+	case codeSecurityCheck:
+		step := &LoginVerifyStep{Type: VerifyTypeUrl, Message: "需要完成网易云安全验证后重试"}
+		if m, ok := data.(map[string]any); ok {
+			for _, k := range []string{"url", "verifyUrl"} {
+				if u, ok := m[k].(string); ok && u != "" {
+					step.Url = u
+					break
+				}
+			}
+		}
+		return step
+	case codeTooManyAttempts:
+		return &LoginVerifyStep{Type: VerifyTypeRetry, Message: "尝试次数过多，请稍后再试"}
+	}
+	return nil
+}
+
+// respondRiskControl 把风控信息原样透传给前端，code 使用网易云的返回码
+func respondRiskControl(ctx *gin.Context, code int64, message string, step *LoginVerifyStep) {
+	if message == "" {
+		message = step.Message
+	}
+	ctx.JSON(http.StatusForbidden, response.Msg(int(code), message, gin.H{"verify": step}))
+}
+
+// beginLoginSession 为一次新的登录生成会话和 cookie 文件，会话在登录完成前只保留 10 分钟
+func beginLoginSession(ctx *gin.Context) (sid string, cookieFile string, err error) {
+	cookieFile = filepath.Join(session.GenerateSessionID(32) + ".json")
+	sid = session.GenerateSessionID(16)
+	if err = session.SetNewCookie(cookieFile, sid); err != nil {
+		return "", "", err
+	}
+	if err = session.RecordClient(sid, ctx.Request.UserAgent(), ctx.ClientIP()); err != nil {
+		return "", "", err
+	}
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie("SessionId", sid, 60*10, "/", "", true, true)
+	return sid, cookieFile, nil
+}
+
+// completeLogin 登录成功后获取用户信息、延长会话，并让客户端失效以便把登录 cookie 写入文件
+func completeLogin(ctx context.Context, sid string, cookieFile string, api *weapi.Api) (*weapi.GetUserInfoResp, error) {
+	user, err := api.GetUserInfo(ctx, &weapi.GetUserInfoReq{})
+	if err != nil {
+		return nil, fmt.Errorf("获取用户信息失败: %w", err)
+	}
+	if err := redis_pool.ExtendTimeForCookie(sid); err != nil {
+		return nil, fmt.Errorf("redis fail to extend time: %w", err)
+	}
+	// 归还时关闭客户端并把登录 cookie 写入文件
+	client.InvalidateNetcloudCli(cookieFile)
+
+	// 登录的账号作为会话的第一个关联账号，并设为当前账号
+	acc, err := linkAccount(sid, cookieFile, user)
+	if err != nil {
+		return nil, fmt.Errorf("fail to link account: %w", err)
+	}
+	if err := session.SetActiveAccount(sid, acc); err != nil {
+		return nil, fmt.Errorf("fail to set active account: %w", err)
+	}
+	return user, nil
+}
+
+// linkAccount 把已登录的账号加入会话，同一账号重新关联时清理旧的 cookie 文件
+func linkAccount(sid string, cookieFile string, user *weapi.GetUserInfoResp) (session.LinkedAccount, error) {
+	acc := session.LinkedAccount{
+		Uid:        user.Account.Id,
+		Nickname:   user.Profile.Nickname,
+		AvatarUrl:  user.Profile.AvatarUrl,
+		CookieFile: cookieFile,
+		LinkedAt:   time.Now(),
+	}
+	oldCookieFile, err := session.AddAccount(sid, acc)
+	if err != nil {
+		return acc, err
+	}
+	if oldCookieFile != "" {
+		// 重新关联的是当前账号时，先把会话指向新的 cookie 文件再清理旧文件
+		if activeAccountUid(sid) == acc.Uid {
+			if err := session.SetActiveAccount(sid, acc); err != nil {
+				return acc, err
+			}
+		}
+		client.PurgeNetcloudCli(oldCookieFile)
+	}
+	if err := session.IndexSession(acc.Uid, sid); err != nil {
+		return acc, err
+	}
+	// 重新登录后恢复因登录失效暂停的任务
+	if err := session.ResumeAccountJobs(acc.Uid); err != nil {
+		log.Logger.Warn("fail to resume account jobs", log.Any("uid", acc.Uid), log.Any("err", err))
+	}
+	return acc, nil
+}
+
+// setLoginCookie 登录完成后把浏览器端 SessionId 延长到会话空闲超时
+func setLoginCookie(ctx *gin.Context, sid string) {
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie("SessionId", sid, int(redis_pool.SessionIdleTimeout().Seconds()), "/", "", true, true)
+	setCSRFHeader(ctx, sid)
+}
+
+// setCSRFHeader 通过响应头下发会话的 CSRF token
+func setCSRFHeader(ctx *gin.Context, sid string) {
+	token, err := session.IssueCSRFToken(sid)
+	if err != nil {
+		log.Logger.Error("fail to issue csrf token", log.Any("err", err))
+		return
+	}
+	ctx.Header(session.CSRFHeader, token)
+}
@@ -22,31 +22,29 @@ package cloudnet
 
 import (
 	"bvtc/client"
-	"bvtc/config"
+	"bvtc/constant"
 	"bvtc/log"
 	"bvtc/response"
+	"bvtc/tool/credential"
 	redis_pool "bvtc/tool/pool"
 	"bvtc/tool/session"
 	"bvtc/tool/socket"
 	"bytes"
 	"context"
-	"errors"
 	"net/http"
-	"os"
-	"path/filepath"
-	"time"
+	"strings"
 
 	"github.com/chaunsin/netease-cloud-music/api/weapi"
-	"github.com/davecgh/go-spew/spew"
 	"github.com/gin-gonic/gin"
 	"github.com/skip2/go-qrcode"
 )
 
 type LoginReq struct {
 	Phone  string `json:"phone"`
-	CtCode int64
+	CtCode int64  `json:"ctcode,omitempty"` // 国家区号，默认 86
 }
 
+// SendByPhone 发送短信验证码，同时创建本次登录的会话
 func SendByPhone(ctx *gin.Context) {
 	var req LoginReq
 	err := ctx.ShouldBindJSON(&req)
@@ -60,49 +58,55 @@ func SendByPhone(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, response.FailMsg("phone number is empty"))
 		return
 	}
-	req.CtCode = 86
+	if req.CtCode == 0 {
+		req.CtCode = 86
+	}
 
-	cookieFile := filepath.Join(session.GenerateSessionID(32) + ".json")
+	sid, cookieFile, err := beginLoginSession(ctx)
+	if err != nil {
+		log.Logger.Error("redis fail to create", log.Any("err : ", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("redis fail to create"))
+		return
+	}
 
-	api, cli, err := client.MultiGetNetcloudApi(cookieFile)
+	api, release, err := client.AcquireNetcloudApi(cookieFile)
 	if err != nil {
 		log.Logger.Error("client fail to init", log.Any("err : ", err))
 		ctx.JSON(http.StatusInternalServerError, response.FailMsg("client fail to init"))
 		return
 	}
-	defer cli.Close(context.Background())
+	defer release()
 
 	//发送验证码
 	resp, err := api.SendSMS(ctx, &weapi.SendSMSReq{Cellphone: req.Phone, CtCode: req.CtCode})
 	if err != nil {
-		log.Logger.Error("email fail to send", log.Any("err : ", err))
-		ctx.JSON(http.StatusInternalServerError, response.FailMsg("email fail to send"))
+		log.Logger.Error("sms fail to send", log.Any("err : ", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("sms fail to send"))
 		return
 	}
-	_ = resp
-
-	sid := session.GenerateSessionID(16)
-	spew.Dump("sid : ", sid)
-	ctx.SetSameSite(http.SameSiteLaxMode)
-	ctx.SetCookie("SessionId", sid, 60*10, "/", "", true, true)
-	err = session.SetNewCookie(cookieFile, sid)
-	if err != nil {
-		log.Logger.Error("redis fail to create", log.Any("err : ", err))
-		ctx.JSON(http.StatusInternalServerError, response.FailMsg("redis fail to create"))
+	if resp.Code != codeLoginSuccess {
+		if step := detectRiskControl(resp.Code, resp.Data); step != nil {
+			log.Logger.Warn("sms blocked by risk control", log.Any("code", resp.Code), log.String("sid", sid))
+			respondRiskControl(ctx, resp.Code, resp.Message, step)
+			return
+		}
+		log.Logger.Error("sms fail to send", log.Any("resp", resp))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg(resp.Message))
 		return
 	}
 
-	log.Logger.Info("email success to send", log.Any("phone : ", req.Phone))
-	ctx.JSON(http.StatusOK, response.SuccessMsg("email success to send"))
+	log.Logger.Info("sms success to send", log.Any("phone : ", req.Phone))
+	ctx.JSON(http.StatusOK, response.SuccessMsg("sms success to send"))
 }
 
 type VerifyReq struct {
 	Phone    string `json:"phone"`
 	Captcha  string `json:"captcha"`
 	Remember bool   `json:"remember"`
-	CtCode   int64
+	CtCode   int64  `json:"ctcode,omitempty"` // 国家区号，默认 86
 }
 
+// VerifyCaptcha 校验短信验证码并登录，需要先调用 SendByPhone
 func VerifyCaptcha(ctx *gin.Context) {
 	sid, err := ctx.Cookie("SessionId")
 	if err != nil {
@@ -110,7 +114,6 @@ func VerifyCaptcha(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to get sessionId"))
 		return
 	}
-	spew.Dump("sid : ", sid)
 	cookieFile := session.GetCookieBySession(sid)
 	if cookieFile == "" {
 		log.Logger.Error("cookie file not found", log.String("sid", sid))
@@ -118,14 +121,6 @@ func VerifyCaptcha(ctx *gin.Context) {
 		return
 	}
 
-	api, cli, err := client.MultiGetNetcloudApi(cookieFile)
-	if err != nil {
-		log.Logger.Error("client fail to init", log.Any("err : ", err))
-		ctx.JSON(http.StatusInternalServerError, response.FailMsg("client fail to init"))
-		return
-	}
-	defer cli.Close(context.Background())
-
 	var req VerifyReq
 	err = ctx.ShouldBindJSON(&req)
 	if err != nil {
@@ -143,7 +138,17 @@ func VerifyCaptcha(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, response.FailMsg("captcha is empty"))
 		return
 	}
-	req.CtCode = 86
+	if req.CtCode == 0 {
+		req.CtCode = 86
+	}
+
+	api, release, err := client.AcquireNetcloudApi(cookieFile)
+	if err != nil {
+		log.Logger.Error("client fail to init", log.Any("err : ", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("client fail to init"))
+		return
+	}
+	defer release()
 
 	//检验验证码
 	resp, err := api.SMSVerify(ctx, &weapi.SMSVerifyReq{Cellphone: req.Phone, Captcha: req.Captcha, CtCode: req.CtCode})
@@ -152,8 +157,8 @@ func VerifyCaptcha(ctx *gin.Context) {
 		ctx.JSON(http.StatusInternalServerError, response.FailMsg("captcha fail to verify"))
 		return
 	}
-	if resp.Code != 200 {
-		log.Logger.Error("captcha fail to verify", log.Any("err : ", err))
+	if resp.Code != codeLoginSuccess {
+		log.Logger.Error("captcha fail to verify", log.Any("resp", resp))
 		ctx.JSON(http.StatusBadRequest, response.FailMsg(resp.Message))
 		return
 	}
@@ -165,34 +170,133 @@ func VerifyCaptcha(ctx *gin.Context) {
 		Captcha:     req.Captcha, // 使用验证码登录
 		Remember:    true,        // 记住登录状态
 	})
-	_ = loginResp
 	if err != nil {
 		log.Logger.Error("fail to netclogin", log.Any("err : ", err))
 		ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to netclogin"))
 		return
 	}
+	if !checkLoginResp(ctx, sid, loginResp.Code, loginResp.Message, loginResp.Data) {
+		return
+	}
+
+	user, err := completeLogin(ctx, sid, cookieFile, api)
+	if err != nil {
+		log.Logger.Error("fail to complete login", log.Any("err : ", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg(err.Error()))
+		return
+	}
+	setLoginCookie(ctx, sid)
 
-	//获取用户信息
-	user, err := api.GetUserInfo(ctx, &weapi.GetUserInfoReq{})
+	log.Logger.Info("user netclogin", log.Any("user : ", user))
+	ctx.JSON(http.StatusOK, response.SuccessMsg(""))
+}
+
+type PasswordLoginReq struct {
+	Account  string `json:"account"`          // 手机号或邮箱
+	Password string `json:"password"`         // 明文密码，由网易云客户端加密
+	CtCode   int64  `json:"ctcode,omitempty"` // 手机号登录时的国家区号，默认 86
+}
+
+// PasswordLogin 手机号或邮箱 + 密码登录，账号中包含 @ 时按邮箱登录
+func PasswordLogin(ctx *gin.Context) {
+	var req PasswordLoginReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		log.Logger.Error("fail to bind json", log.Any("err : ", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to bind json"))
+		return
+	}
+	req.Account = strings.TrimSpace(req.Account)
+	if req.Account == "" || req.Password == "" {
+		log.Logger.Error("account or password is empty")
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("account or password is empty"))
+		return
+	}
+	if req.CtCode == 0 {
+		req.CtCode = 86
+	}
+
+	sid, cookieFile, err := beginLoginSession(ctx)
 	if err != nil {
-		log.Logger.Error("获取用户信息失败", log.Any("err : ", err))
-		ctx.JSON(http.StatusInternalServerError, response.FailMsg("获取用户信息失败"))
+		log.Logger.Error("redis fail to create", log.Any("err : ", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("redis fail to create"))
 		return
 	}
 
-	ctx.SetSameSite(http.SameSiteLaxMode)
-	ctx.SetCookie("SessionId", sid, 60*60*24*7, "/", "", true, true)
-	err = redis_pool.ExtendTimeForCookie(sid)
+	api, release, err := client.AcquireNetcloudApi(cookieFile)
 	if err != nil {
-		log.Logger.Error("redis fail to extend time", log.Any("err : ", err))
-		ctx.JSON(http.StatusInternalServerError, response.FailMsg("redis fail to extend time"))
+		log.Logger.Error("client fail to init", log.Any("err : ", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("client fail to init"))
 		return
 	}
+	defer release()
 
-	log.Logger.Info("user netclogin", log.Any("user : ", user))
+	var (
+		code    int64
+		message string
+		data    any
+	)
+	if strings.Contains(req.Account, "@") {
+		resp, err := api.LoginEmail(ctx, &weapi.LoginEmailReq{
+			Username: req.Account,
+			Password: req.Password,
+			Remember: true,
+		})
+		if err != nil {
+			log.Logger.Error("fail to netclogin", log.Any("err : ", err))
+			ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to netclogin"))
+			return
+		}
+		code, message, data = resp.Code, resp.Message, resp.Data
+	} else {
+		resp, err := api.LoginCellphone(ctx, &weapi.LoginCellphoneReq{
+			Phone:       req.Account,
+			Countrycode: req.CtCode,
+			Password:    req.Password,
+			Remember:    true,
+		})
+		if err != nil {
+			log.Logger.Error("fail to netclogin", log.Any("err : ", err))
+			ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to netclogin"))
+			return
+		}
+		code, message, data = resp.Code, resp.Message, resp.Data
+	}
+	if !checkLoginResp(ctx, sid, code, message, data) {
+		return
+	}
+
+	user, err := completeLogin(ctx, sid, cookieFile, api)
+	if err != nil {
+		log.Logger.Error("fail to complete login", log.Any("err : ", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg(err.Error()))
+		return
+	}
+	setLoginCookie(ctx, sid)
+
+	log.Logger.Info("user netclogin by password", log.Any("user : ", user))
 	ctx.JSON(http.StatusOK, response.SuccessMsg(""))
 }
 
+// checkLoginResp 检查登录接口返回码，失败时直接写入响应并返回 false
+func checkLoginResp(ctx *gin.Context, sid string, code int64, message string, data any) bool {
+	switch code {
+	case codeLoginSuccess:
+		return true
+	case codeAccountNotExist, codeWrongPassword:
+		log.Logger.Info("netclogin rejected", log.Any("code", code), log.String("sid", sid))
+		ctx.JSON(http.StatusBadRequest, response.FailCodeMsg(int(code), "账号或密码错误"))
+		return false
+	}
+	if step := detectRiskControl(code, data); step != nil {
+		log.Logger.Warn("netclogin blocked by risk control", log.Any("code", code), log.String("sid", sid))
+		respondRiskControl(ctx, code, message, step)
+		return false
+	}
+	log.Logger.Error("fail to netclogin", log.Any("code", code), log.String("message", message))
+	ctx.JSON(http.StatusBadRequest, response.FailCodeMsg(int(code), message))
+	return false
+}
+
 func CheckCookie(ctx *gin.Context) {
 	// 先从 cookie 读取 SessionId，再到 Redis 查询对应的 cookie 文件名
 	sid, err := ctx.Cookie("SessionId")
@@ -212,32 +316,39 @@ func CheckCookie(ctx *gin.Context) {
 		return
 	}
 
-	// 检查cookie文件是否存在且有内容
-	cfg := config.GetConfig()
-	cookieFilePath := filepath.Join(filepath.Clean(cfg.Api.Cookie.Filepath), cookieFile)
-	if _, err := os.ReadFile(cookieFilePath); err != nil {
-		log.Logger.Error("Cookie file not found or cannot be read", log.String("filePath", cookieFilePath), log.Any("err", err))
+	// 检查凭据是否存在
+	if !credential.Exists(cookieFile) {
+		log.Logger.Error("Cookie file not found or cannot be read", log.String("cookieFile", cookieFile))
 		ctx.JSON(http.StatusBadRequest, response.FailMsg("Cookie file not found"))
 		return
-	} else {
-		log.Logger.Info("Cookie file content")
+	}
+	// 后台健康检查已发现登录失效
+	if session.CredentialExpired(cookieFile) {
+		log.Logger.Info("user need relogin", log.String("cookieFile", cookieFile))
+		ctx.JSON(http.StatusUnauthorized, response.FailCodeMsg(constant.CodeReloginRequired, "网易云登录已失效，请重新登录"))
+		return
 	}
 
-	api, _, err := client.MultiInitNetcloudCli(cookieFile)
+	api, release, err := client.AcquireNetcloudApi(cookieFile)
 	if err != nil {
 		log.Logger.Error("client fail to init", log.Any("err : ", err))
 		ctx.JSON(http.StatusInternalServerError, response.FailMsg("client fail to init"))
 		return
 	}
+	defer release()
 
 	status := api.NeedLogin(context.Background())
 
 	if status {
 		log.Logger.Error("user need login")
+		if err := session.MarkCredentialExpired(cookieFile, activeAccountUid(sid)); err != nil {
+			log.Logger.Warn("fail to mark credential expired", log.Any("err", err))
+		}
 		ctx.JSON(http.StatusBadRequest, response.FailMsg("user need login"))
 		return
 	}
 	log.Logger.Info("user already login")
+	setCSRFHeader(ctx, sid)
 	ctx.JSON(http.StatusOK, response.SuccessMsg("user already login"))
 }
 
@@ -248,46 +359,28 @@ func DeleteCookie(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to get sessionId"))
 		return
 	}
-	rdb := redis_pool.GetRdb()
-	rtcx := redis_pool.GetRctx()
-	key := "session:" + sid
-	// 读取 cookie 文件名
-	cookieFile, _ := rdb.HGet(rtcx, key, "cookieFile").Result()
-
-	// 删除磁盘上的 cookie 文件
-	if cookieFile != "" {
-		cfg := config.GetConfig()
-		// 生成与创建时相同的路径：<cfg.Api.Cookie.Filepath>/<cookieFile>
-		filePath := filepath.Join(filepath.Clean(cfg.Api.Cookie.Filepath), cookieFile)
-		// filePath := filepath.Join(append(strings.Split(cfg.Api.Cookie.Filepath, "/"), cookieFile)...)
-		if err := os.Remove(filePath); err != nil {
-			if !os.IsNotExist(err) {
-				log.Logger.Error("failed to remove cookie file", log.Any("file", filePath), log.Any("err", err))
-			}
-		}
-	}
-
-	// 删除 Redis 中的会话数据
-	rdb.Del(rtcx, key)
-
-	// 清除浏览器端 SessionId Cookie（保持与设置时同样的属性）
-	ctx.SetSameSite(http.SameSiteLaxMode)
-	ctx.SetCookie("SessionId", "", -1, "/", "", true, true)
+	// 删除会话及所有关联账号的凭据
+	destroySession(sid)
+	clearSessionCookie(ctx)
 
 	ctx.JSON(http.StatusOK, response.SuccessMsg("cookie deleted"))
 }
 
 // 二维码登录
 func GetLoginQrcode(ctx *gin.Context) {
-	cookieFile := filepath.Join(session.GenerateSessionID(32) + ".json")
-	api, cli, err := client.MultiGetNetcloudApi(cookieFile)
+	sid, cookieFile, err := beginLoginSession(ctx)
+	if err != nil {
+		log.Logger.Error("redis fail to set", log.Any("err : ", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("redis fail to set"))
+		return
+	}
+	api, release, err := client.AcquireNetcloudApi(cookieFile)
 	if err != nil {
 		log.Logger.Error("client fail to init", log.Any("err : ", err))
 		ctx.JSON(http.StatusInternalServerError, response.FailMsg("client fail to init"))
 		return
 	}
-	defer cli.Close(context.Background())
-	spew.Dump("cookieFile : ", cookieFile)
+	defer release()
 
 	// 创建二维码key
 	qrKey, err := api.QrcodeCreateKey(ctx, &weapi.QrcodeCreateKeyReq{Type: 1})
@@ -310,22 +403,12 @@ func GetLoginQrcode(ctx *gin.Context) {
 		return
 	}
 
-	sid := session.GenerateSessionID(16)
-	ctx.SetSameSite(http.SameSiteLaxMode)
-	ctx.SetCookie("SessionId", sid, 60*10, "/", "", true, true)
-
 	err = session.SetNewQrcodeUniKey(sid, qrKey.UniKey)
 	if err != nil {
 		log.Logger.Error("redis fail to set", log.Any("err : ", err))
 		ctx.JSON(http.StatusInternalServerError, response.FailMsg("redis fail to set"))
 		return
 	}
-	err = session.SetNewCookie(cookieFile, sid)
-	if err != nil {
-		log.Logger.Error("redis fail to set", log.Any("err : ", err))
-		ctx.JSON(http.StatusInternalServerError, response.FailMsg("redis fail to set"))
-		return
-	}
 
 	ctx.Header("Content-Type", "image/png")
 	ctx.Header("Cache-Control", "no-cache, no-store")
@@ -344,42 +427,7 @@ func sendSocketResponse(wsClient *socket.Client, sid string, code int, msg strin
 	return true
 }
 
-func processQrcodeStatus(pollCtx context.Context, wsClient *socket.Client, sid string, api *weapi.Api, resp *weapi.QrcodeCheckResp) bool {
-	switch resp.Code {
-	case 800:
-		_ = session.DelQrcodeUniKey(sid)
-		sendSocketResponse(wsClient, sid, 800, "qr is not exist or expired", nil)
-		return true
-	case 801:
-		sendSocketResponse(wsClient, sid, 801, "waiting for scan", nil)
-		return false
-	case 802:
-		sendSocketResponse(wsClient, sid, 802, "waiting for confirm", nil)
-		return false
-	case 803:
-		user, err := api.GetUserInfo(pollCtx, &weapi.GetUserInfoReq{})
-		if err != nil {
-			log.Logger.Error("get user info failed", log.Any("err : ", err))
-			sendSocketResponse(wsClient, sid, 500, "获取用户信息失败", nil)
-			return true
-		}
-
-		if err := redis_pool.ExtendTimeForCookie(sid); err != nil {
-			log.Logger.Error("redis fail to extend time", log.Any("err : ", err))
-			sendSocketResponse(wsClient, sid, 500, "redis fail to extend time", nil)
-			return true
-		}
-
-		_ = session.DelQrcodeUniKey(sid)
-		sendSocketResponse(wsClient, sid, 200, "success to login", user)
-		return true
-	default:
-		log.Logger.Error("unknown qrcode status", log.Any("resp : ", resp))
-		sendSocketResponse(wsClient, sid, 500, "unknown qrcode status", nil)
-		return true
-	}
-}
-
+// CheckLoginQrcode 推送二维码扫码状态，支持 websocket、SSE 和长轮询
 func CheckLoginQrcode(ctx *gin.Context) {
 	sid, err := ctx.Cookie("SessionId")
 	if err != nil {
@@ -400,66 +448,15 @@ func CheckLoginQrcode(ctx *gin.Context) {
 		return
 	}
 
-	wsClient, err := socket.Upgrade(ctx, sid)
-	if err != nil {
-		log.Logger.Error("upgrade websocket failed", log.Any("err", err), log.String("sid", sid))
-		return
-	}
-	defer wsClient.Close()
-
-	api, cli, err := client.MultiGetNetcloudApi(cookieFile)
-	if err != nil {
-		log.Logger.Error("client fail to init", log.Any("err : ", err))
-		sendSocketResponse(wsClient, sid, 500, "client fail to init", nil)
-		return
-	}
-	defer cli.Close(context.Background())
-
-	log.Logger.Debug("start ws")
-
-	pollCtx, cancel := context.WithTimeout(ctx.Request.Context(), 3*time.Minute)
-	defer cancel()
-
-	ticker := time.NewTicker(3 * time.Second)
-	defer ticker.Stop()
-
-	var lastCode int64 = -1
-	initialResp, err := api.QrcodeCheck(pollCtx, &weapi.QrcodeCheckReq{Type: 1, Key: unikey})
-	if err != nil {
-		log.Logger.Error("fail to login", log.Any("err : ", err))
-		sendSocketResponse(wsClient, sid, 500, "fail to login", nil)
-		return
-	}
-	lastCode = initialResp.Code
-	if processQrcodeStatus(pollCtx, wsClient, sid, api, initialResp) {
-		return
-	}
-
-	for {
-		select {
-		case <-wsClient.Done():
-			return
-		case <-pollCtx.Done():
-			if errors.Is(pollCtx.Err(), context.DeadlineExceeded) {
-				sendSocketResponse(wsClient, sid, 408, "request timeout", nil)
-			}
-			return
-		case <-ticker.C:
-			resp, err := api.QrcodeCheck(pollCtx, &weapi.QrcodeCheckReq{Type: 1, Key: unikey})
-			if err != nil {
-				log.Logger.Error("fail to login", log.Any("err : ", err))
-				sendSocketResponse(wsClient, sid, 500, "fail to login", nil)
-				return
-			}
-
-			if resp.Code == lastCode && resp.Code != 803 {
-				continue
-			}
-			lastCode = resp.Code
-
-			if processQrcodeStatus(pollCtx, wsClient, sid, api, resp) {
-				return
-			}
-		}
-	}
+	serveQrcodeStatus(ctx, &qrcodeWatch{
+		id:         "login:" + sid + ":" + unikey,
+		sid:        sid,
+		cookieFile: cookieFile,
+		unikey:     unikey,
+		successMsg: "success to login",
+		confirm: func(c context.Context, api *weapi.Api) (any, error) {
+			return completeLogin(c, sid, cookieFile, api)
+		},
+		cleanup: func(bool) { _ = session.DelQrcodeUniKey(sid, unikey) },
+	})
 }
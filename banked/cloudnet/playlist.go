@@ -23,96 +23,381 @@ package cloudnet
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"bvtc/client"
+	"bvtc/constant"
 	"bvtc/log"
 	"bvtc/response"
-	redis_pool "bvtc/tool/pool"
+	"bvtc/tool/session"
 
 	"github.com/chaunsin/netease-cloud-music/api/types"
 	"github.com/chaunsin/netease-cloud-music/api/weapi"
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	playlistDefaultLimit = 100
+	playlistMaxLimit     = 1000
+)
+
+type ShowPlaylistReq struct {
+	Offset  int64 `form:"offset"`
+	Limit   int64 `form:"limit"`
+	Account int64 `form:"account"` // 关联账号 uid，默认使用会话当前账号
+}
+
 type ShowPlaylistResp struct {
-	PName string `json:"pname"`
-	Pid   int64  `json:"pid"`
+	Playlists  []PlaylistItem `json:"playlists"`
+	Offset     int64          `json:"offset"`
+	Limit      int64          `json:"limit"`
+	More       bool           `json:"more"`                 // 是否还有下一页
+	NextOffset int64          `json:"nextOffset,omitempty"` // 下一页的 offset
+}
+
+type PlaylistItem struct {
+	PName       string `json:"pname"`
+	Pid         int64  `json:"pid"`
+	TrackCount  int64  `json:"trackCount"`
+	CoverUrl    string `json:"coverUrl"`
+	Privacy     int64  `json:"privacy"`          // 0 公开，10 隐私
+	Owned       bool   `json:"owned"`            // 自己创建的歌单，可以添加歌曲
+	Subscribed  bool   `json:"subscribed"`       // 收藏的歌单
+	Collab      *bool  `json:"collab,omitempty"` // 他人创建并共享给自己的歌单；仅歌单列表能识别，详情中不返回
+	CreatorId   int64  `json:"creatorId"`
+	CreatorName string `json:"creatorName"`
 }
 
 func ShowPlaylist(ctx *gin.Context) {
+	var req ShowPlaylistReq
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		log.Logger.Error("bind query fail", log.Any("err : ", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("bind query fail"))
+		return
+	}
+	if req.Offset < 0 {
+		req.Offset = 0
+	}
+	if req.Limit <= 0 {
+		req.Limit = playlistDefaultLimit
+	}
+	if req.Limit > playlistMaxLimit {
+		req.Limit = playlistMaxLimit
+	}
+
 	sid, err := ctx.Cookie("SessionId")
 	if err != nil {
 		log.Logger.Error("fail to get sessionId", log.Any("err : ", err))
 		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to get sessionId"))
 		return
 	}
-	rdb := redis_pool.GetRdb()
-	rtcx := redis_pool.GetRctx()
-	key := "session:" + sid
-	cookieFile, rerr := rdb.HGet(rtcx, key, "cookieFile").Result()
+	// 未指定账号时使用会话当前账号
+	cookieFile, rerr := session.ResolveCookieFile(sid, req.Account)
 	if rerr != nil || cookieFile == "" {
 		log.Logger.Error("session not found or expired", log.Any("err : ", rerr))
 		ctx.JSON(http.StatusBadRequest, response.FailMsg("session not found or expired"))
 		return
 	}
 
-	api, _, err := client.MultiInitNetcloudCli(cookieFile)
+	api, release, err := client.AcquireNetcloudApi(cookieFile)
 	if err != nil {
 		log.Logger.Error("client fail to init", log.Any("err : ", err))
 		ctx.JSON(http.StatusInternalServerError, response.FailMsg("client fail to init"))
 		return
 	}
+	defer release()
 
-	//	通过判断用户名找出自己的歌单，存入歌单id和名字
+	// 通过用户ID区分自己创建的歌单和收藏的歌单
 	userinfo, err := api.GetUserInfo(ctx, &weapi.GetUserInfoReq{})
-	username := userinfo.Profile.Nickname
 	if err != nil {
 		log.Logger.Error("userinfo fail to get", log.Any("err : ", err))
 		ctx.JSON(http.StatusInternalServerError, response.FailMsg(err.Error()))
 		return
 	}
-	playlist, err := api.Playlist(ctx, &weapi.PlaylistReq{Uid: strconv.FormatInt(userinfo.Account.Id, 10)})
+	uid := userinfo.Account.Id
+	playlist, err := api.Playlist(ctx, &weapi.PlaylistReq{
+		Uid:    strconv.FormatInt(uid, 10),
+		Offset: req.Offset,
+		Limit:  req.Limit,
+	})
 	if err != nil {
 		log.Logger.Error("fail to get playlist", log.Any("err : ", err))
 		ctx.JSON(http.StatusInternalServerError, response.FailMsg(err.Error()))
 		return
 	}
-	var resp []ShowPlaylistResp
+
+	resp := ShowPlaylistResp{
+		Playlists: make([]PlaylistItem, 0, len(playlist.Playlist)),
+		Offset:    req.Offset,
+		Limit:     req.Limit,
+		More:      playlist.More,
+	}
 	for i := range playlist.Playlist {
-		if playlist.Playlist[i].Creator.Nickname == username {
-			resp = append(resp, ShowPlaylistResp{
-				PName: playlist.Playlist[i].Name,
-				Pid:   playlist.Playlist[i].Id,
-			})
+		p := playlist.Playlist[i]
+		owned, subscribed, collab := playlistOwnership(uid, p.UserId, p.Creator.UserId, p.Subscribed, p.SpecialType)
+		resp.Playlists = append(resp.Playlists, PlaylistItem{
+			PName:       p.Name,
+			Pid:         p.Id,
+			TrackCount:  p.TrackCount,
+			CoverUrl:    p.CoverImgUrl,
+			Privacy:     p.Privacy,
+			Owned:       owned,
+			Subscribed:  subscribed,
+			Collab:      &collab,
+			CreatorId:   p.Creator.UserId,
+			CreatorName: p.Creator.Nickname,
+		})
+	}
+	if resp.More {
+		resp.NextOffset = req.Offset + int64(len(playlist.Playlist))
+	}
+	log.Logger.Info("success to get playlist",
+		log.Any("uid", uid),
+		log.Int("count", len(resp.Playlists)),
+		log.Any("more", resp.More))
+	ctx.JSON(http.StatusOK, response.SuccessMsg(resp))
+}
+
+type PlaylistDetailResp struct {
+	PlaylistItem
+	Tracks   []PlaylistTrack `json:"tracks"`
+	TrackIds []int64         `json:"trackIds"` // 歌单内全部歌曲ID，顺序与歌单一致
+}
+
+type PlaylistTrack struct {
+	Id       int64    `json:"id"`
+	Name     string   `json:"name"`
+	Artists  []string `json:"artists"`
+	Album    string   `json:"album"`
+	CoverUrl string   `json:"coverUrl"`
+	Duration int64    `json:"duration"` // 毫秒
+}
+
+// ShowPlaylistDetail 获取歌单详情和歌曲列表，便于上传前查看目标歌单已有内容
+func ShowPlaylistDetail(ctx *gin.Context) {
+	pid, err := strconv.ParseInt(ctx.Param("pid"), 10, 64)
+	if err != nil || pid <= 0 {
+		log.Logger.Error("invalid pid", log.String("pid", ctx.Param("pid")))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("invalid pid"))
+		return
+	}
+
+	sid, err := ctx.Cookie("SessionId")
+	if err != nil {
+		log.Logger.Error("fail to get sessionId", log.Any("err : ", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to get sessionId"))
+		return
+	}
+	account, _ := strconv.ParseInt(ctx.Query("account"), 10, 64)
+	// 未指定账号时使用会话当前账号
+	cookieFile, rerr := session.ResolveCookieFile(sid, account)
+	if rerr != nil || cookieFile == "" {
+		log.Logger.Error("session not found or expired", log.Any("err : ", rerr))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("session not found or expired"))
+		return
+	}
+
+	api, release, err := client.AcquireNetcloudApi(cookieFile)
+	if err != nil {
+		log.Logger.Error("client fail to init", log.Any("err : ", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("client fail to init"))
+		return
+	}
+	defer release()
+
+	userinfo, err := api.GetUserInfo(ctx, &weapi.GetUserInfoReq{})
+	if err != nil {
+		log.Logger.Error("userinfo fail to get", log.Any("err : ", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg(err.Error()))
+		return
+	}
+
+	detail, err := getPlaylistDetail(ctx, api, pid)
+	if err != nil {
+		log.Logger.Error("fail to get playlist detail", log.Any("pid", pid), log.Any("err : ", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg(err.Error()))
+		return
+	}
+
+	p := detail.Playlist
+	uid := userinfo.Account.Id
+	// 详情接口不返回歌单类型，无法判断是否为共享歌单，响应中不带 collab
+	owned, subscribed, _ := playlistOwnership(uid, p.UserId, p.Creator.UserId, p.Subscribed, 0)
+	resp := PlaylistDetailResp{
+		PlaylistItem: PlaylistItem{
+			PName:       p.Name,
+			Pid:         p.Id,
+			TrackCount:  p.TrackCount,
+			CoverUrl:    p.CoverImgUrl,
+			Privacy:     p.Privacy,
+			Owned:       owned,
+			Subscribed:  subscribed,
+			CreatorId:   p.Creator.UserId,
+			CreatorName: p.Creator.Nickname,
+		},
+		Tracks:   make([]PlaylistTrack, 0, len(p.Tracks)),
+		TrackIds: make([]int64, 0, len(p.TrackIds)),
+	}
+	for i := range p.Tracks {
+		t := p.Tracks[i]
+		artists := make([]string, 0, len(t.Ar))
+		for _, ar := range t.Ar {
+			artists = append(artists, ar.Name)
 		}
+		resp.Tracks = append(resp.Tracks, PlaylistTrack{
+			Id:       t.Id,
+			Name:     t.Name,
+			Artists:  artists,
+			Album:    t.Al.Name,
+			CoverUrl: t.Al.PicUrl,
+			Duration: t.Dt,
+		})
+	}
+	for _, t := range p.TrackIds {
+		resp.TrackIds = append(resp.TrackIds, t.Id)
 	}
-	log.Logger.Info("success to get playlist", log.Any("resp", resp))
 	ctx.JSON(http.StatusOK, response.SuccessMsg(resp))
 }
 
-type UploadToMusicReq struct {
+// 歌单列表中 specialType 为该值时表示共享歌单
+const playlistSpecialTypeShared = 300
+
+// playlistOwnership 按用户ID判断歌单归属，不再依赖昵称比较。
+// 共享歌单只根据 specialType 判断，其余既非自建也非收藏的歌单三项均为 false
+func playlistOwnership(uid, userId, creatorId int64, subscribed bool, specialType int64) (owned, sub, collab bool) {
+	owned = userId == uid || creatorId == uid
+	collab = !owned && specialType == playlistSpecialTypeShared
+	return owned, !owned && !collab && subscribed, collab
+}
+
+// getPlaylistDetail 获取歌单详情
+func getPlaylistDetail(ctx context.Context, api *weapi.Api, pid int64) (*weapi.PlaylistDetailResp, error) {
+	detail, err := api.PlaylistDetail(ctx, &weapi.PlaylistDetailReq{Id: strconv.FormatInt(pid, 10)})
+	if err != nil {
+		return nil, err
+	}
+	if detail.Code != 200 {
+		return nil, fmt.Errorf("playlist detail code %d: %s", detail.Code, detail.Message)
+	}
+	return detail, nil
+}
+
+// 单次 manipulate/tracks 请求携带的歌曲数量上限
+const playlistBatchSize = 100
+
+type AddTracksReq struct {
 	Pid      int64
-	TrackIds int64
+	TrackIds []int64 // 按期望在歌单中出现的顺序排列
+	Position string  // constant.PlaylistPositionTop / constant.PlaylistPositionBottom
 }
 
-func UploadToPlaylist(req UploadToMusicReq, cookiefile string) error {
-	api, _, err := client.MultiInitNetcloudCli(cookiefile)
+// AddTracksToPlaylist 分批把歌曲加入歌单，并按请求顺序放到歌单顶部或底部。
+// 返回值 failed 记录每首未能加入歌单的歌曲及原因；reorderErr 表示歌曲已加入但未能调整顺序；
+// err 仅表示整体流程失败（如客户端初始化失败）。
+func AddTracksToPlaylist(req AddTracksReq, cookiefile string) (failed map[int64]error, reorderErr error, err error) {
+	failed = make(map[int64]error)
+	if len(req.TrackIds) == 0 {
+		return failed, nil, nil
+	}
+
+	api, release, err := client.AcquireNetcloudApi(cookiefile)
 	if err != nil {
 		log.Logger.Error("client fail to init", log.Any("err : ", err))
-		return errors.New("client fail to init")
+		return nil, nil, errors.New("client fail to init")
+	}
+	defer release()
+
+	// 去重，保持首次出现的顺序
+	seen := make(map[int64]struct{}, len(req.TrackIds))
+	trackIds := make([]int64, 0, len(req.TrackIds))
+	for _, id := range req.TrackIds {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		trackIds = append(trackIds, id)
 	}
-	resp, err := api.PlaylistAddOrDel(context.Background(), &weapi.PlaylistAddOrDelReq{Op: "add", Pid: req.Pid, 
-	TrackIds: types.IntsString{req.TrackIds}, Imme: true})
+
+	for start := 0; start < len(trackIds); start += playlistBatchSize {
+		end := min(start+playlistBatchSize, len(trackIds))
+		batch := trackIds[start:end]
+		batchErr := playlistManipulate(api, "add", req.Pid, batch)
+		if batchErr == nil {
+			continue
+		}
+		log.Logger.Warn("batch add to playlist failed, retry one by one",
+			log.Any("pid", req.Pid), log.Int("size", len(batch)), log.Any("err", batchErr))
+		// 整批失败时逐首重试，定位具体失败的歌曲
+		for _, id := range batch {
+			if addErr := playlistManipulate(api, "add", req.Pid, []int64{id}); addErr != nil {
+				failed[id] = addErr
+			}
+		}
+	}
+
+	added := make([]int64, 0, len(trackIds))
+	for _, id := range trackIds {
+		if _, ok := failed[id]; !ok {
+			added = append(added, id)
+		}
+	}
+	if len(added) == 0 {
+		return failed, nil, nil
+	}
+
+	// 网易云并发添加后的顺序不可控，这里统一按请求顺序重排一次
+	reorderErr = reorderPlaylist(api, req.Pid, added, req.Position)
+	if reorderErr != nil {
+		log.Logger.Warn("fail to reorder playlist", log.Any("pid", req.Pid), log.Any("err", reorderErr))
+	}
+
+	log.Logger.Info("success to add tracks to playlist",
+		log.Any("pid", req.Pid), log.Int("added", len(added)), log.Int("failed", len(failed)))
+	return failed, reorderErr, nil
+}
+
+// playlistManipulate 调用 manipulate/tracks，op 为 add / del / update
+func playlistManipulate(api *weapi.Api, op string, pid int64, trackIds []int64) error {
+	resp, err := api.PlaylistAddOrDel(ctx, &weapi.PlaylistAddOrDelReq{
+		Op:       op,
+		Pid:      pid,
+		TrackIds: types.IntsString(trackIds),
+		Imme:     true,
+	})
 	if err != nil {
-		log.Logger.Error("fail", log.Any("err", err))
-		return errors.New("fail to upload to playlist")
+		return fmt.Errorf("fail to %s playlist tracks: %w", op, err)
 	}
 	if resp.Code != 200 {
-		log.Logger.Error("fail to upload to playlist", log.Any("resp", resp))
-		return errors.New("fail to upload to playlist")
+		return fmt.Errorf("fail to %s playlist tracks: code %d %s", op, resp.Code, resp.Message)
 	}
-	log.Logger.Info("success to upload to playlist", log.Any("resp", resp))
 	return nil
 }
+
+// reorderPlaylist 把 added 按顺序整体放到歌单顶部或底部，其余歌曲保持原有相对顺序
+func reorderPlaylist(api *weapi.Api, pid int64, added []int64, position string) error {
+	detail, err := getPlaylistDetail(ctx, api, pid)
+	if err != nil {
+		return err
+	}
+
+	addedSet := make(map[int64]struct{}, len(added))
+	for _, id := range added {
+		addedSet[id] = struct{}{}
+	}
+	others := make([]int64, 0, len(detail.Playlist.TrackIds))
+	for _, t := range detail.Playlist.TrackIds {
+		if _, ok := addedSet[t.Id]; !ok {
+			others = append(others, t.Id)
+		}
+	}
+
+	ordered := make([]int64, 0, len(others)+len(added))
+	if position == constant.PlaylistPositionBottom {
+		ordered = append(append(ordered, others...), added...)
+	} else {
+		ordered = append(append(ordered, added...), others...)
+	}
+	return playlistManipulate(api, "update", pid, ordered)
+}
@@ -0,0 +1,362 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cloudnet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bvtc/client"
+	"bvtc/log"
+	"bvtc/response"
+	redis_pool "bvtc/tool/pool"
+	"bvtc/tool/socket"
+
+	"github.com/chaunsin/netease-cloud-music/api/weapi"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	qrcodeWatchTimeout  = 3 * time.Minute  // 单次二维码轮询的最长时间
+	qrcodePollInterval  = 3 * time.Second  // 向网易云查询扫码状态的间隔
+	qrcodeLongPollWait  = 25 * time.Second // 长轮询请求最长挂起时间
+	qrcodeSSEHeartbeat  = 10 * time.Second
+	qrcodeTransportSSE  = "sse"
+	qrcodeTransportPoll = "poll"
+)
+
+// qrcodeWatch 描述一次二维码轮询，登录和关联账号共用。
+// 轮询在任意一个副本的后台执行，状态变化通过 Redis 发布，任何副本都可以向前端推送。
+type qrcodeWatch struct {
+	id         string // 轮询标识，区分登录和关联账号，包含 unikey，重新生成二维码时不复用旧状态
+	sid        string
+	cookieFile string
+	unikey     string
+	successMsg string
+	// confirm 扫码确认（803）后调用，返回值发送给前端
+	confirm func(ctx context.Context, api *weapi.Api) (any, error)
+	// cleanup 轮询结束时清理二维码信息，success 表示扫码是否成功
+	cleanup func(success bool)
+}
+
+func qrcodeStateKey(id string) string {
+	return "qrcode:state:" + id
+}
+
+func qrcodeChannel(id string) string {
+	return "qrcode:status:" + id
+}
+
+func qrcodePollerKey(id string) string {
+	return "qrcode:poller:" + id
+}
+
+// qrcodeTerminal 是否为结束状态，801/802 之外的状态都不会再变化
+func qrcodeTerminal(code int) bool {
+	return code != 801 && code != 802
+}
+
+// start 没有副本在轮询时启动后台轮询
+func (w *qrcodeWatch) start() error {
+	rdb := redis_pool.GetRdb()
+	rtcx := redis_pool.GetRctx()
+	ok, err := rdb.SetNX(rtcx, qrcodePollerKey(w.id), 1, qrcodeWatchTimeout+30*time.Second).Result()
+	if err != nil {
+		return err
+	}
+	if ok {
+		go w.poll()
+	}
+	return nil
+}
+
+// poll 定期查询扫码状态，状态变化时发布，直到结束或超时
+func (w *qrcodeWatch) poll() {
+	defer redis_pool.GetRdb().Del(redis_pool.GetRctx(), qrcodePollerKey(w.id))
+
+	api, release, err := client.AcquireNetcloudApi(w.cookieFile)
+	if err != nil {
+		log.Logger.Error("client fail to init", log.Any("err : ", err))
+		w.publish(response.Msg(500, "client fail to init", nil))
+		w.cleanup(false)
+		return
+	}
+	defer release()
+
+	pollCtx, cancel := context.WithTimeout(context.Background(), qrcodeWatchTimeout)
+	defer cancel()
+	ticker := time.NewTicker(qrcodePollInterval)
+	defer ticker.Stop()
+
+	var lastCode int64 = -1
+	for {
+		resp, err := api.QrcodeCheck(pollCtx, &weapi.QrcodeCheckReq{Type: 1, Key: w.unikey})
+		if err != nil {
+			if errors.Is(pollCtx.Err(), context.DeadlineExceeded) {
+				w.publish(response.Msg(408, "request timeout", nil))
+			} else {
+				log.Logger.Error("fail to login", log.Any("err : ", err))
+				w.publish(response.Msg(500, "fail to login", nil))
+			}
+			w.cleanup(false)
+			return
+		}
+		if resp.Code != lastCode || resp.Code == 803 {
+			lastCode = resp.Code
+			if done, success := w.process(pollCtx, api, resp); done {
+				w.cleanup(success)
+				return
+			}
+		}
+
+		select {
+		case <-pollCtx.Done():
+			w.publish(response.Msg(408, "request timeout", nil))
+			w.cleanup(false)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// process 发布一次扫码状态，返回轮询是否结束以及是否成功
+func (w *qrcodeWatch) process(pollCtx context.Context, api *weapi.Api, resp *weapi.QrcodeCheckResp) (done bool, success bool) {
+	switch resp.Code {
+	case 800:
+		w.publish(response.Msg(800, "qr is not exist or expired", nil))
+		return true, false
+	case 801:
+		w.publish(response.Msg(801, "waiting for scan", nil))
+		return false, false
+	case 802:
+		w.publish(response.Msg(802, "waiting for confirm", nil))
+		return false, false
+	case 803:
+		data, err := w.confirm(pollCtx, api)
+		if err != nil {
+			log.Logger.Error("fail to complete login", log.Any("err : ", err))
+			w.publish(response.Msg(500, err.Error(), nil))
+			return true, false
+		}
+		w.publish(response.Msg(200, w.successMsg, data))
+		return true, true
+	default:
+		log.Logger.Error("unknown qrcode status", log.Any("resp : ", resp))
+		w.publish(response.Msg(500, "unknown qrcode status", nil))
+		return true, false
+	}
+}
+
+// publish 保存最新状态供后来的请求读取，并通知所有订阅者
+func (w *qrcodeWatch) publish(msg *response.ResponseMsg) {
+	rdb := redis_pool.GetRdb()
+	rtcx := redis_pool.GetRctx()
+	b, err := json.Marshal(msg)
+	if err != nil {
+		log.Logger.Error("fail to marshal qrcode status", log.Any("err", err))
+		return
+	}
+	pipe := rdb.TxPipeline()
+	pipe.Set(rtcx, qrcodeStateKey(w.id), b, qrcodeWatchTimeout+time.Minute)
+	pipe.Publish(rtcx, qrcodeChannel(w.id), b)
+	if _, err := pipe.Exec(rtcx); err != nil {
+		log.Logger.Error("fail to publish qrcode status", log.Any("err", err), log.String("id", w.id))
+	}
+}
+
+// loadQrcodeState 读取最新状态，还没有状态时返回 nil
+func loadQrcodeState(id string) *response.ResponseMsg {
+	b, err := redis_pool.GetRdb().Get(redis_pool.GetRctx(), qrcodeStateKey(id)).Bytes()
+	if err != nil {
+		return nil
+	}
+	return decodeQrcodeStatus(b)
+}
+
+func decodeQrcodeStatus(b []byte) *response.ResponseMsg {
+	var msg response.ResponseMsg
+	if err := json.Unmarshal(b, &msg); err != nil {
+		log.Logger.Error("fail to decode qrcode status", log.Any("err", err))
+		return nil
+	}
+	return &msg
+}
+
+// serveQrcodeStatus 启动轮询并按客户端选择的方式推送状态：
+// 默认 websocket，?transport=sse 使用 SSE，?transport=poll&since=<上次状态码> 使用长轮询
+func serveQrcodeStatus(ctx *gin.Context, w *qrcodeWatch) {
+	// 先订阅再启动轮询和读取当前状态，避免漏掉状态变化
+	pubsub := redis_pool.GetRdb().Subscribe(ctx.Request.Context(), qrcodeChannel(w.id))
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx.Request.Context()); err != nil {
+		log.Logger.Error("fail to subscribe qrcode status", log.Any("err", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to subscribe qrcode status"))
+		return
+	}
+	if err := w.start(); err != nil {
+		log.Logger.Error("fail to start qrcode watch", log.Any("err", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to start qrcode watch"))
+		return
+	}
+	current := loadQrcodeState(w.id)
+	events := pubsub.Channel()
+
+	switch ctx.Query("transport") {
+	case qrcodeTransportSSE:
+		serveQrcodeSSE(ctx, w, current, events)
+	case qrcodeTransportPoll:
+		serveQrcodeLongPoll(ctx, w, current, events)
+	default:
+		serveQrcodeWebSocket(ctx, w, current, events)
+	}
+}
+
+func serveQrcodeWebSocket(ctx *gin.Context, w *qrcodeWatch, current *response.ResponseMsg, events <-chan *redis.Message) {
+	wsClient, err := socket.Upgrade(ctx, w.sid)
+	if err != nil {
+		log.Logger.Error("upgrade websocket failed", log.Any("err", err), log.String("sid", w.sid))
+		return
+	}
+	defer wsClient.Close()
+
+	forwardQrcodeStatus(ctx, current, events, wsClient.Done(), nil, func(msg *response.ResponseMsg) bool {
+		return sendSocketResponse(wsClient, w.sid, msg.Code, msg.Msg, msg.Data)
+	})
+}
+
+func serveQrcodeSSE(ctx *gin.Context, w *qrcodeWatch, current *response.ResponseMsg, events <-chan *redis.Message) {
+	flusher, ok := ctx.Writer.(http.Flusher)
+	if !ok {
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("stream unsupported"))
+		return
+	}
+	// 与 websocket 一致：推送开始前把 SessionId 延长，登录成功后无需再次设置
+	setLoginCookie(ctx, w.sid)
+	ctx.Writer.Header().Set("Content-Type", "text/event-stream")
+	ctx.Writer.Header().Set("Cache-Control", "no-cache")
+	ctx.Writer.Header().Set("Connection", "keep-alive")
+	ctx.Writer.Header().Set("X-Accel-Buffering", "no")
+	if rc := http.NewResponseController(ctx.Writer); rc != nil {
+		_ = rc.SetWriteDeadline(time.Now().Add(qrcodeWatchTimeout + time.Minute))
+	}
+	ctx.Status(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(qrcodeSSEHeartbeat)
+	defer heartbeat.Stop()
+	forwardQrcodeStatus(ctx, current, events, ctx.Request.Context().Done(), heartbeat.C, func(msg *response.ResponseMsg) bool {
+		if msg == nil {
+			_, err := ctx.Writer.WriteString(": ping\n\n")
+			flusher.Flush()
+			return err == nil
+		}
+		ctx.SSEvent("status", msg)
+		flusher.Flush()
+		return true
+	})
+}
+
+// forwardQrcodeStatus 把当前状态和后续变化交给 send，直到结束状态、客户端断开或超时；
+// heartbeat 触发时以 nil 调用 send
+func forwardQrcodeStatus(ctx *gin.Context, current *response.ResponseMsg, events <-chan *redis.Message, closed <-chan struct{}, heartbeat <-chan time.Time, send func(msg *response.ResponseMsg) bool) {
+	lastCode := -1
+	deliver := func(msg *response.ResponseMsg) (done bool) {
+		if msg == nil || msg.Code == lastCode {
+			return false
+		}
+		lastCode = msg.Code
+		return !send(msg) || qrcodeTerminal(msg.Code)
+	}
+	if deliver(current) {
+		return
+	}
+
+	timeout := time.NewTimer(qrcodeWatchTimeout + 10*time.Second)
+	defer timeout.Stop()
+	for {
+		select {
+		case m, ok := <-events:
+			if !ok {
+				return
+			}
+			if deliver(decodeQrcodeStatus([]byte(m.Payload))) {
+				return
+			}
+		case <-heartbeat:
+			if !send(nil) {
+				return
+			}
+		case <-closed:
+			return
+		case <-ctx.Request.Context().Done():
+			return
+		case <-timeout.C:
+			return
+		}
+	}
+}
+
+// serveQrcodeLongPoll 状态与 since 不同时立即返回，否则最多挂起 qrcodeLongPollWait 后返回当前状态
+func serveQrcodeLongPoll(ctx *gin.Context, w *qrcodeWatch, current *response.ResponseMsg, events <-chan *redis.Message) {
+	since, _ := strconv.Atoi(ctx.Query("since"))
+	reply := func(msg *response.ResponseMsg) {
+		if msg == nil {
+			msg = response.Msg(801, "waiting for scan", nil)
+		}
+		if msg.Code == 200 {
+			setLoginCookie(ctx, w.sid)
+		}
+		ctx.JSON(http.StatusOK, msg)
+	}
+	if current != nil && current.Code != since {
+		reply(current)
+		return
+	}
+
+	wait := time.NewTimer(qrcodeLongPollWait)
+	defer wait.Stop()
+	for {
+		select {
+		case m, ok := <-events:
+			if !ok {
+				reply(current)
+				return
+			}
+			if msg := decodeQrcodeStatus([]byte(m.Payload)); msg != nil {
+				current = msg
+				if msg.Code != since {
+					reply(msg)
+					return
+				}
+			}
+		case <-wait.C:
+			reply(current)
+			return
+		case <-ctx.Request.Context().Done():
+			return
+		}
+	}
+}
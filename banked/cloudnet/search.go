@@ -0,0 +1,98 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cloudnet
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// 网易云公开搜索接口，不需要登录
+const searchURL = "https://music.163.com/api/search/get/web"
+
+// SearchSong 搜索到的歌曲
+type SearchSong struct {
+	Id       int64    `json:"id"`
+	Name     string   `json:"name"`
+	Artists  []string `json:"artists"`
+	Duration int      `json:"duration"` // 秒
+}
+
+type searchResp struct {
+	Code   int `json:"code"`
+	Result struct {
+		Songs []struct {
+			Id      int64  `json:"id"`
+			Name    string `json:"name"`
+			Artists []struct {
+				Name string `json:"name"`
+			} `json:"artists"`
+			Duration int64 `json:"duration"` // 毫秒
+		} `json:"songs"`
+	} `json:"result"`
+}
+
+var searchClient = resty.New().
+	SetTimeout(10*time.Second).
+	SetHeader("Referer", "https://music.163.com/").
+	SetHeader("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36")
+
+// SearchSongs 按关键词搜索单曲，返回前 limit 首
+func SearchSongs(ctx context.Context, keyword string, limit int) ([]SearchSong, error) {
+	if keyword == "" {
+		return nil, fmt.Errorf("keyword is empty")
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+	var sr searchResp
+	resp, err := searchClient.R().
+		SetContext(ctx).
+		SetQueryParams(map[string]string{
+			"s":      keyword,
+			"type":   "1", // 单曲
+			"limit":  strconv.Itoa(limit),
+			"offset": "0",
+		}).
+		SetResult(&sr).
+		ForceContentType("application/json").
+		Get(searchURL)
+	if err != nil {
+		return nil, fmt.Errorf("search request failed: %w", err)
+	}
+	if resp.StatusCode() != 200 || sr.Code != 200 {
+		return nil, fmt.Errorf("search failed: status %d, code %d", resp.StatusCode(), sr.Code)
+	}
+
+	songs := make([]SearchSong, 0, len(sr.Result.Songs))
+	for _, s := range sr.Result.Songs {
+		song := SearchSong{Id: s.Id, Name: s.Name, Duration: int(s.Duration / 1000)}
+		for _, a := range s.Artists {
+			song.Artists = append(song.Artists, a.Name)
+		}
+		songs = append(songs, song)
+	}
+	return songs, nil
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cloudnet
+
+import (
+	"net/http"
+	"time"
+
+	"bvtc/client"
+	"bvtc/log"
+	"bvtc/response"
+	redis_pool "bvtc/tool/pool"
+	"bvtc/tool/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SessionItem struct {
+	Id         string    `json:"id"` // 会话标识，用于撤销，不是 SessionId
+	Current    bool      `json:"current"`
+	UserAgent  string    `json:"userAgent"`
+	Ip         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+}
+
+type RevokeSessionReq struct {
+	Id string `json:"id"`
+}
+
+type RevokeAllSessionsReq struct {
+	IncludeCurrent bool `json:"includeCurrent"` // 是否同时退出当前会话
+}
+
+// ListSessions 列出当前账号在所有设备上的登录会话
+func ListSessions(ctx *gin.Context) {
+	sid, err := ctx.Cookie("SessionId")
+	if err != nil {
+		log.Logger.Error("fail to get sessionId", log.Any("err : ", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to get sessionId"))
+		return
+	}
+	_, sessions, ok := currentAccountSessions(ctx, sid)
+	if !ok {
+		return
+	}
+
+	items := make([]SessionItem, 0, len(sessions))
+	for _, s := range sessions {
+		items = append(items, SessionItem{
+			Id:         session.PublicID(s.Sid),
+			Current:    s.Sid == sid,
+			UserAgent:  s.UserAgent,
+			Ip:         s.IP,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+		})
+	}
+	ctx.JSON(http.StatusOK, response.SuccessMsg(items))
+}
+
+// RevokeSession 撤销当前账号的某个会话，并删除其凭据
+func RevokeSession(ctx *gin.Context) {
+	sid, err := ctx.Cookie("SessionId")
+	if err != nil {
+		log.Logger.Error("fail to get sessionId", log.Any("err : ", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to get sessionId"))
+		return
+	}
+	var req RevokeSessionReq
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.Id == "" {
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("id is required"))
+		return
+	}
+	uid, sessions, ok := currentAccountSessions(ctx, sid)
+	if !ok {
+		return
+	}
+
+	for _, s := range sessions {
+		if session.PublicID(s.Sid) != req.Id {
+			continue
+		}
+		revokeAccountSession(s.Sid, uid)
+		if s.Sid == sid {
+			clearSessionCookie(ctx)
+		}
+		log.Logger.Info("session revoked", log.String("by", sid), log.String("id", req.Id))
+		ctx.JSON(http.StatusOK, response.SuccessMsg(""))
+		return
+	}
+	ctx.JSON(http.StatusNotFound, response.FailMsg("session not found"))
+}
+
+// RevokeAllSessions 撤销当前账号的所有其他会话和个人访问令牌，includeCurrent 为 true 时当前会话也退出
+func RevokeAllSessions(ctx *gin.Context) {
+	sid, err := ctx.Cookie("SessionId")
+	if err != nil {
+		log.Logger.Error("fail to get sessionId", log.Any("err : ", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to get sessionId"))
+		return
+	}
+	var req RevokeAllSessionsReq
+	// 请求体可以为空
+	_ = ctx.ShouldBindJSON(&req)
+
+	uid, sessions, ok := currentAccountSessions(ctx, sid)
+	if !ok {
+		return
+	}
+	revoked := 0
+	for _, s := range sessions {
+		if s.Sid == sid && !req.IncludeCurrent {
+			continue
+		}
+		revokeAccountSession(s.Sid, uid)
+		revoked++
+	}
+	// 个人访问令牌的会话不在设备列表中，退出所有设备时一并撤销
+	tokens, err := session.ListAPITokens(uid)
+	if err != nil {
+		log.Logger.Error("fail to list api tokens", log.Any("err", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to revoke tokens"))
+		return
+	}
+	for i := range tokens {
+		if err := revokeAPIToken(&tokens[i]); err != nil {
+			log.Logger.Error("fail to delete api token", log.String("id", tokens[i].Id), log.Any("err", err))
+			continue
+		}
+		revoked++
+	}
+	if req.IncludeCurrent {
+		clearSessionCookie(ctx)
+	}
+
+	log.Logger.Info("sessions revoked", log.String("by", sid), log.Int("count", revoked))
+	ctx.JSON(http.StatusOK, response.SuccessMsg(gin.H{"revoked": revoked}))
+}
+
+// currentAccountSessions 获取会话当前账号及其所有会话（包括只关联了该账号的会话），失败时直接写入响应
+func currentAccountSessions(ctx *gin.Context, sid string) (int64, []session.SessionInfo, bool) {
+	uid := activeAccountUid(sid)
+	if uid == 0 {
+		// 旧会话没有记录 uid，先补登记当前账号
+		acc, err := backfillActiveAccount(ctx, sid)
+		if err != nil {
+			log.Logger.Error("fail to backfill account", log.Any("err", err))
+			ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to get account"))
+			return 0, nil, false
+		}
+		uid = acc.Uid
+	}
+	sessions, err := session.AccountSessions(uid)
+	if err != nil {
+		log.Logger.Error("fail to list sessions", log.Any("err", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to list sessions"))
+		return 0, nil, false
+	}
+	return uid, sessions, true
+}
+
+// revokeAccountSession 撤销会话中 uid 账号的登录：uid 是该会话的当前账号时删除整个会话，
+// 只是关联账号时仅取消关联并删除该账号的凭据，会话中其他账号和哔哩哔哩登录不受影响
+func revokeAccountSession(sid string, uid int64) {
+	if activeAccountUid(sid) == uid {
+		destroySession(sid)
+		return
+	}
+	acc, err := session.GetAccount(sid, uid)
+	if err != nil {
+		// 关联已被取消，只需清理索引
+		_ = session.UnindexSession(uid, sid)
+		return
+	}
+	if err := session.RemoveAccount(sid, uid); err != nil {
+		log.Logger.Warn("fail to remove account", log.Any("uid", uid), log.Any("err", err))
+		return
+	}
+	client.PurgeNetcloudCli(acc.CookieFile)
+	_ = session.UnindexSession(uid, sid)
+}
+
+// destroySession 删除会话、关联账号及其所有 cookie
+func destroySession(sid string) {
+	rdb := redis_pool.GetRdb()
+	rtcx := redis_pool.GetRctx()
+	key := "session:" + sid
+
+	// 关闭共享客户端并删除凭据，包括所有关联账号
+	cookieFile, _ := rdb.HGet(rtcx, key, "cookieFile").Result()
+	if cookieFile != "" {
+		client.PurgeNetcloudCli(cookieFile)
+	}
+	if uid := activeAccountUid(sid); uid != 0 {
+		_ = session.UnindexSession(uid, sid)
+	}
+	accounts, _ := session.ListAccounts(sid)
+	for _, acc := range accounts {
+		if acc.CookieFile != cookieFile {
+			client.PurgeNetcloudCli(acc.CookieFile)
+		}
+		_ = session.UnindexSession(acc.Uid, sid)
+	}
+
+	// 删除哔哩哔哩登录凭据
+	if err := session.DelBiliCredential(sid); err != nil {
+		log.Logger.Warn("fail to delete bilibili credential", log.String("sid", sid), log.Any("err", err))
+	}
+
+	// 删除 Redis 中的会话数据
+	rdb.Del(rtcx, key)
+	_ = session.DelAccounts(sid)
+}
+
+// clearSessionCookie 清除浏览器端 SessionId Cookie（保持与设置时同样的属性）
+func clearSessionCookie(ctx *gin.Context) {
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie("SessionId", "", -1, "/", "", true, true)
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cloudnet
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"bvtc/constant"
+	"bvtc/log"
+	"bvtc/response"
+	"bvtc/tool/credential"
+	"bvtc/tool/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 令牌最长有效期
+const maxTokenExpiresDays = 365
+
+type TokenItem struct {
+	Id         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"` // 为空表示永不过期
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+type CreateTokenReq struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expiresInDays"` // 0 表示永不过期
+}
+
+type RevokeTokenReq struct {
+	Id string `json:"id"`
+}
+
+// ListTokens 列出当前账号的个人访问令牌
+func ListTokens(ctx *gin.Context) {
+	sid, err := ctx.Cookie("SessionId")
+	if err != nil {
+		log.Logger.Error("fail to get sessionId", log.Any("err : ", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to get sessionId"))
+		return
+	}
+	uid := activeAccountUid(sid)
+	if uid == 0 {
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("session not found or expired"))
+		return
+	}
+	tokens, err := session.ListAPITokens(uid)
+	if err != nil {
+		log.Logger.Error("fail to list api tokens", log.Any("err", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to list tokens"))
+		return
+	}
+	items := make([]TokenItem, 0, len(tokens))
+	for _, tok := range tokens {
+		items = append(items, tokenItem(tok))
+	}
+	ctx.JSON(http.StatusOK, response.SuccessMsg(items))
+}
+
+// CreateToken 为当前账号生成个人访问令牌，令牌明文只在创建时返回一次
+func CreateToken(ctx *gin.Context) {
+	sid, err := ctx.Cookie("SessionId")
+	if err != nil {
+		log.Logger.Error("fail to get sessionId", log.Any("err : ", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to get sessionId"))
+		return
+	}
+	var req CreateTokenReq
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		log.Logger.Error("bind json fail", log.Any("err", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("invalid request format"))
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len([]rune(req.Name)) > 64 {
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("name is required and must be at most 64 characters"))
+		return
+	}
+	if len(req.Scopes) == 0 {
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("scopes is required"))
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !session.ValidScope(scope) {
+			ctx.JSON(http.StatusBadRequest, response.FailMsg("invalid scope: "+scope))
+			return
+		}
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxTokenExpiresDays {
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("expiresInDays must be between 0 and 365"))
+		return
+	}
+
+	uid := activeAccountUid(sid)
+	cookieFile := session.GetCookieBySession(sid)
+	if uid == 0 || cookieFile == "" {
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("session not found or expired"))
+		return
+	}
+	if session.CredentialExpired(cookieFile) {
+		ctx.JSON(http.StatusUnauthorized, response.FailCodeMsg(constant.CodeReloginRequired, "网易云登录已失效，请重新登录"))
+		return
+	}
+
+	// 令牌使用自己的凭据副本，浏览器会话退出登录不影响令牌
+	raw, err := credential.Get(cookieFile)
+	if err != nil {
+		log.Logger.Error("fail to read credential", log.Any("err", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to create token"))
+		return
+	}
+	tokenCookieFile := session.GenerateSessionID(32) + ".json"
+	if err := credential.Put(tokenCookieFile, raw); err != nil {
+		log.Logger.Error("fail to copy credential", log.Any("err", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to create token"))
+		return
+	}
+	tokenSid, err := session.NewTokenSession(tokenCookieFile, uid)
+	if err != nil {
+		log.Logger.Error("fail to create token session", log.Any("err", err))
+		_ = credential.Delete(tokenCookieFile)
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to create token"))
+		return
+	}
+
+	tok := session.APIToken{
+		Name:   req.Name,
+		Uid:    uid,
+		Sid:    tokenSid,
+		Scopes: req.Scopes,
+	}
+	if req.ExpiresInDays > 0 {
+		tok.ExpiresAt = time.Now().Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour)
+	}
+	plain, tok, err := session.CreateAPIToken(tok)
+	if err != nil {
+		log.Logger.Error("fail to create api token", log.Any("err", err))
+		destroySession(tokenSid)
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to create token"))
+		return
+	}
+
+	log.Logger.Info("api token created", log.Any("uid", uid), log.String("id", tok.Id), log.Any("scopes", tok.Scopes))
+	ctx.JSON(http.StatusOK, response.SuccessMsg(gin.H{
+		"token": plain,
+		"item":  tokenItem(tok),
+	}))
+}
+
+// RevokeToken 撤销当前账号的令牌，并删除令牌会话和凭据副本
+func RevokeToken(ctx *gin.Context) {
+	sid, err := ctx.Cookie("SessionId")
+	if err != nil {
+		log.Logger.Error("fail to get sessionId", log.Any("err : ", err))
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to get sessionId"))
+		return
+	}
+	var req RevokeTokenReq
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.Id == "" {
+		ctx.JSON(http.StatusBadRequest, response.FailMsg("id is required"))
+		return
+	}
+
+	tok, err := session.GetAPIToken(req.Id)
+	if errors.Is(err, session.ErrAPITokenNotFound) || (err == nil && tok.Uid != activeAccountUid(sid)) {
+		ctx.JSON(http.StatusNotFound, response.FailMsg("token not found"))
+		return
+	}
+	if err != nil {
+		log.Logger.Error("fail to get api token", log.Any("err", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to get token"))
+		return
+	}
+
+	if err := revokeAPIToken(tok); err != nil {
+		log.Logger.Error("fail to delete api token", log.Any("err", err))
+		ctx.JSON(http.StatusInternalServerError, response.FailMsg("fail to revoke token"))
+		return
+	}
+	ctx.JSON(http.StatusOK, response.SuccessMsg(""))
+}
+
+// revokeAPIToken 删除令牌会话、凭据副本和令牌记录
+func revokeAPIToken(tok *session.APIToken) error {
+	destroySession(tok.Sid)
+	if err := session.DeleteAPIToken(tok); err != nil {
+		return err
+	}
+	log.Logger.Info("api token revoked", log.Any("uid", tok.Uid), log.String("id", tok.Id))
+	return nil
+}
+
+func tokenItem(tok session.APIToken) TokenItem {
+	item := TokenItem{
+		Id:        tok.Id,
+		Name:      tok.Name,
+		Scopes:    tok.Scopes,
+		CreatedAt: tok.CreatedAt,
+	}
+	if !tok.ExpiresAt.IsZero() {
+		item.ExpiresAt = &tok.ExpiresAt
+	}
+	if !tok.LastUsedAt.IsZero() {
+		item.LastUsedAt = &tok.LastUsedAt
+	}
+	return item
+}
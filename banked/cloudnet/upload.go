@@ -42,41 +42,52 @@ import (
 
 var ctx context.Context = context.Background()
 
-func UploadToNetCloud(filename string, splaylist bool, pid int64, cookiefile string) error {
+// UploadToNetCloud 上传文件到网易云云盘并发布，返回云盘歌曲ID。
+// name 为云盘中显示的文件名（不含扩展名），为空时使用本地文件名；
+// bitrateKbps 为转换时的输出比特率，小于等于 0 时使用默认值
+func UploadToNetCloud(filename string, name string, cookiefile string, bitrateKbps int) (int64, error) {
 	// 检查文件是否存在
 	ext := filepath.Ext(filename)
+	uploadName := filepath.Base(filename)
+	if name != "" {
+		uploadName = name + ext
+	}
 	bitrate := constant.BitRate
+	if bitrateKbps > 0 {
+		bitrate = strconv.Itoa(bitrateKbps * 1000)
+	}
 
-	api, _, err := client.MultiInitNetcloudCli(cookiefile)
+	api, release, err := client.AcquireNetcloudApi(cookiefile)
 	if err != nil {
 		log.Logger.Error("client fail to init", log.Any("err : ", err))
-		return errors.New("client fail to init")
+		return 0, errors.New("client fail to init")
 	}
+	defer release()
 
 	// 读取文件
 	file, err := os.Open(filename)
 	if err != nil {
 		log.Logger.Error("fail to open file", log.Any("err : ", err))
-		return errors.New("file error")
+		return 0, errors.New("file error")
 	}
 	defer file.Close()
 
 	stat, err := file.Stat()
 	if err != nil {
 		log.Logger.Error("fail to start file", log.Any("err : ", err))
-		return errors.New("file error")
+		return 0, errors.New("file error")
 	}
 
 	hash := md5.New()
 	if _, err := io.Copy(hash, file); err != nil {
 		log.Logger.Error("fail to calculate file md5", log.Any("err", err))
-		return errors.New("file md5 error")
+		return 0, errors.New("file md5 error")
 	}
 	md5Sum := hex.EncodeToString(hash.Sum(nil))
 
 	if _, err := file.Seek(0, io.SeekStart); err != nil {
 		log.Logger.Error("fail to seek file to start", log.Any("err", err))
-		return errors.New("file seek error")
+		return 0, errors.New("file seek error")
 	}
 
 	// 检查此文件是否需要上传
@@ -91,22 +102,22 @@ func UploadToNetCloud(filename string, splaylist bool, pid int64, cookiefile str
 	resp, err := api.CloudUploadCheck(ctx, &checkReq)
 	if err != nil {
 		log.Logger.Error("fail to get token", log.Any("err : ", err))
-		return errors.New("fail to get token")
+		return 0, errors.New("fail to get token")
 	}
 	if resp == nil {
 		log.Logger.Error("token response is nil")
-		return errors.New("token Code is not compare")
+		return 0, errors.New("token Code is not compare")
 	}
 	if resp.Code != 200 {
 		log.Logger.Error("token Code is not 200", log.Any("Code : ", resp.Code))
-		return errors.New("token Code is not compare")
+		return 0, errors.New("token Code is not compare")
 	}
 
 	// 获取上传凭证
 	allocReq := weapi.CloudTokenAllocReq{
 		Bucket:     "", // jd-musicrep-privatecloud-audio-public
 		Ext:        ext,
-		Filename:   filepath.Base(filename),
+		Filename:   uploadName,
 		Local:      "false",
 		NosProduct: "3",
 		Type:       "audio",
@@ -115,15 +126,15 @@ func UploadToNetCloud(filename string, splaylist bool, pid int64, cookiefile str
 	allocResp, err := api.CloudTokenAlloc(ctx, &allocReq)
 	if err != nil {
 		log.Logger.Error("fail to get token", log.Any("err : ", err))
-		return errors.New("fail to get token")
+		return 0, errors.New("fail to get token")
 	}
 	if allocResp == nil {
 		log.Logger.Error("alloc token response is nil")
-		return errors.New("token Code is not compare")
+		return 0, errors.New("token Code is not compare")
 	}
 	if allocResp.Code != 200 {
 		log.Logger.Error("token Code is not 200", log.Any("Code : ", allocResp.Code))
-		return errors.New("token Code is not compare")
+		return 0, errors.New("token Code is not compare")
 	}
 
 	// 上传文件
@@ -137,15 +148,15 @@ func UploadToNetCloud(filename string, splaylist bool, pid int64, cookiefile str
 		uploadResp, err := api.CloudUpload(ctx, &uploadReq)
 		if err != nil {
 			log.Logger.Error("fail to upload", log.Any("err : ", err))
-			return errors.New("fail to upload")
+			return 0, errors.New("fail to upload")
 		}
 		if uploadResp == nil {
 			log.Logger.Error("upload response is nil")
-			return errors.New("upload Code is not compare")
+			return 0, errors.New("upload Code is not compare")
 		}
 		if uploadResp.ErrCode != "" {
 			log.Logger.Error("fail to upload", log.Any("Code : ", uploadResp.ErrCode))
-			return errors.New("upload Code is not compare")
+			return 0, errors.New("upload Code is not compare")
 		}
 	}
 
@@ -153,13 +164,13 @@ func UploadToNetCloud(filename string, splaylist bool, pid int64, cookiefile str
 	metadata, err := tag.ReadFrom(file)
 	if err != nil {
 		log.Logger.Error("fail to upload", log.Any("err : ", err))
-		return errors.New("fail to upload")
+		return 0, errors.New("fail to upload")
 	}
 	InfoReq := weapi.CloudInfoReq{
 		Md5:        md5Sum,
 		SongId:     resp.SongId,
-		Filename:   stat.Name(),
-		Song:       utils.Ternary(metadata.Title() != "", metadata.Title(), filepath.Base(filename)),
+		Filename:   uploadName,
+		Song:       utils.Ternary(metadata.Title() != "", metadata.Title(), uploadName),
 		Album:      utils.Ternary(metadata.Album() != "", metadata.Album(), "未知专辑"),
 		Artist:     utils.Ternary(metadata.Artist() != "", metadata.Artist(), "未知艺术家"),
 		Bitrate:    bitrate,
@@ -169,11 +180,11 @@ func UploadToNetCloud(filename string, splaylist bool, pid int64, cookiefile str
 	infoResp, err := api.CloudInfo(ctx, &InfoReq)
 	if err != nil {
 		log.Logger.Error("fail to upload music imformation", log.Any("err : ", err))
-		return errors.New("fail to upload music imformation")
+		return 0, errors.New("fail to upload music imformation")
 	}
 	if infoResp.Code != 200 {
 		log.Logger.Error("fail to upload music imformation", log.Any("Code : ", infoResp.Code))
-		return errors.New("upload Code is not compare")
+		return 0, errors.New("upload Code is not compare")
 	}
 
 	// 对上传得歌曲进行发布，和自己账户做关联,不然云盘列表看不到上传得歌曲信息
@@ -183,7 +194,7 @@ func UploadToNetCloud(filename string, splaylist bool, pid int64, cookiefile str
 	publishResp, err := api.CloudPublish(ctx, &publishReq)
 	if err != nil {
 		log.Logger.Error("fail to publish", log.Any("err : ", err))
-		return errors.New("fail to publish")
+		return 0, errors.New("fail to publish")
 	}
 
 	switch publishResp.Code {
@@ -191,27 +202,16 @@ func UploadToNetCloud(filename string, splaylist bool, pid int64, cookiefile str
 		log.Logger.Info("success to upload", log.Any("filename : ", filename))
 	case 201:
 		log.Logger.Info("the music already exists", log.Any("filename : ", filename))
-		return errors.New("the music already exists")
+		return 0, errors.New("the music already exists")
 	default:
 		log.Logger.Error("fail to publish", log.Any("filename : ", filename))
-		return errors.New("upload Code is not compare")
+		return 0, errors.New("upload Code is not compare")
 	}
 
-	// 判断是否要加入歌单还是只保存网盘
-	if splaylist {
-		trackId, err := strconv.ParseInt(infoResp.SongId, 10, 64)
-		if err != nil {
-			log.Logger.Error("转换歌曲ID失败", log.Any("err", err))
-			return errors.New("fail to convert song id")
-		}
-		err = UploadToPlaylist(UploadToMusicReq{
-			Pid:      pid,
-			TrackIds: trackId,
-		}, cookiefile)
-		if err != nil {
-			log.Logger.Error("添加到歌单失败", log.Any("err", err))
-			return errors.New("fail to add to playlist")
-		}
+	songId, err := strconv.ParseInt(infoResp.SongId, 10, 64)
+	if err != nil {
+		log.Logger.Error("转换歌曲ID失败", log.Any("err", err))
+		return 0, errors.New("fail to convert song id")
 	}
-	return nil
+	return songId, nil
 }
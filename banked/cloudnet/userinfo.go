@@ -25,8 +25,11 @@ import (
 	"bvtc/log"
 	"bvtc/response"
 	redis_pool "bvtc/tool/pool"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/chaunsin/netease-cloud-music/api/weapi"
 	"github.com/gin-gonic/gin"
@@ -48,12 +51,13 @@ func GetUserAvatar(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to get cookiefile"))
 		return
 	}
-	api, _, err := client.MultiInitNetcloudCli(cookiefile)
+	api, release, err := client.AcquireNetcloudApi(cookiefile)
 	if err != nil {
 		log.Logger.Error("fail to init netcloud client", log.Any("err", err))
 		ctx.JSON(http.StatusBadRequest, response.FailMsg("fail to init netcloud client"))
 		return
 	}
+	defer release()
 	userinfo, err := api.GetUserInfo(ctx, &weapi.GetUserInfoReq{})
 	if err != nil {
 		log.Logger.Error("fail to get userinfo", log.Any("err", err))
@@ -95,3 +99,55 @@ func GetUserAvatar(ctx *gin.Context) {
 	ctx.Data(http.StatusOK, resp.Header.Get("Content-Type"), imageData)
 
 }
+
+type CloudCapacity struct {
+	Used  int64 `json:"used"`  // 已用空间（字节）
+	Max   int64 `json:"max"`   // 总空间（字节）
+	Count int64 `json:"count"` // 云盘歌曲数量
+}
+
+// GetCloudCapacity 查询云盘容量，只取第一页即可拿到 size/maxSize
+func GetCloudCapacity(cookiefile string) (*CloudCapacity, error) {
+	api, release, err := client.AcquireNetcloudApi(cookiefile)
+	if err != nil {
+		log.Logger.Error("client fail to init", log.Any("err : ", err))
+		return nil, errors.New("client fail to init")
+	}
+	defer release()
+
+	resp, err := api.CloudList(ctx, &weapi.CloudListReq{Limit: 1, Offset: 0})
+	if err != nil {
+		log.Logger.Error("fail to get cloud list", log.Any("err", err))
+		return nil, errors.New("fail to get cloud list")
+	}
+	if resp.Code != 200 {
+		log.Logger.Error("fail to get cloud list", log.Any("Code", resp.Code))
+		return nil, fmt.Errorf("fail to get cloud list: code %d", resp.Code)
+	}
+	used, err := strconv.ParseInt(resp.Size, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cloud size %q", resp.Size)
+	}
+	maxSize, err := strconv.ParseInt(resp.MaxSize, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cloud max size %q", resp.MaxSize)
+	}
+	return &CloudCapacity{Used: used, Max: maxSize, Count: resp.Count}, nil
+}
+
+// GetAccountId 获取 cookie 文件对应的网易云用户ID
+func GetAccountId(cookiefile string) (int64, error) {
+	api, release, err := client.AcquireNetcloudApi(cookiefile)
+	if err != nil {
+		log.Logger.Error("client fail to init", log.Any("err : ", err))
+		return 0, errors.New("client fail to init")
+	}
+	defer release()
+
+	userinfo, err := api.GetUserInfo(ctx, &weapi.GetUserInfoReq{})
+	if err != nil {
+		log.Logger.Error("fail to get userinfo", log.Any("err", err))
+		return 0, errors.New("fail to get userinfo")
+	}
+	return userinfo.Account.Id, nil
+}
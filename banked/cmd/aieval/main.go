@@ -0,0 +1,105 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// aieval 离线评估标题建议：把标注数据逐条交给指定的 Provider，输出精确/模糊匹配准确率和耗时。
+//
+//	go run ./cmd/aieval -dataset ai/aititle/testdata/titles.jsonl -provider ollama -base-url http://127.0.0.1:11434 -model qwen2.5:1.5b
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"bvtc/ai/aititle"
+	"bvtc/ai/providers"
+	"bvtc/log"
+
+	"go.uber.org/zap"
+)
+
+func main() {
+	var (
+		dataset  = flag.String("dataset", "ai/aititle/testdata/titles.jsonl", "标注数据（JSONL）")
+		provider = flag.String("provider", "ollama", "Provider："+fmt.Sprint(providers.Names()))
+		baseURL  = flag.String("base-url", "http://127.0.0.1:11434", "模型服务地址")
+		model    = flag.String("model", "qwen2.5:1.5b", "模型名称")
+		apiKey   = flag.String("api-key", os.Getenv("AI_API_KEY"), "openai 兼容服务的 API Key")
+		prompt   = flag.String("prompt", "", "提示词模板文件，为空时使用内置模板")
+		timeout  = flag.Duration("timeout", 2*time.Minute, "单条超时")
+		rules    = flag.Bool("rules", false, "先走规则解析，与线上行为一致")
+		output   = flag.String("json", "", "逐条结果写入的 JSON 文件")
+		verbose  = flag.Bool("v", false, "输出每条结果")
+	)
+	flag.Parse()
+	log.Logger = zap.NewNop()
+
+	samples, err := aititle.LoadEvalDataset(*dataset)
+	if err != nil {
+		fatal("load dataset: %v", err)
+	}
+	p, err := providers.New(*provider, providers.Options{
+		BaseURL:     *baseURL,
+		Model:       *model,
+		APIKey:      *apiKey,
+		Temperature: providers.DefaultTemperature,
+		Timeout:     *timeout,
+	})
+	if err != nil {
+		fatal("%v", err)
+	}
+	opts := aititle.EvalOptions{Timeout: *timeout, UseRules: *rules}
+	if *prompt != "" {
+		if opts.Prompt, err = aititle.LoadPrompt(*prompt); err != nil {
+			fatal("%v", err)
+		}
+	}
+
+	report := aititle.Evaluate(context.Background(), p, samples, opts)
+	if *verbose {
+		for _, r := range report.Results {
+			mark := "✗"
+			switch {
+			case r.Exact:
+				mark = "✓"
+			case r.Fuzzy:
+				mark = "~"
+			}
+			fmt.Printf("%s %-6s %8s  %q -> %q (expected %q) %s\n",
+				mark, r.Method, r.Latency.Round(time.Millisecond), r.Title, r.Got, r.Expected, r.Error)
+		}
+	}
+	fmt.Println(report.Summary())
+
+	if *output != "" {
+		b, _ := json.MarshalIndent(report, "", "  ")
+		if err := os.WriteFile(*output, b, 0o644); err != nil {
+			fatal("write report: %v", err)
+		}
+	}
+}
+
+func fatal(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
@@ -21,6 +21,8 @@
 package config
 
 import (
+	"errors"
+	"io/fs"
 	"log"
 	"path/filepath"
 	"time"
@@ -39,6 +41,12 @@ type YamlConfig struct {
 	Music    MusicConfig    `mapstructure:"music"`
 	Security SecurityConfig `mapstructure:"security"`
 	Ai       AIConfig       `mapstructure:"Ai"`
+	Janitor  JanitorConfig  `mapstructure:"janitor"`
+}
+
+type JanitorConfig struct {
+	Interval    time.Duration `mapstructure:"interval"`      // 清理孤立凭据和临时文件的间隔
+	MediaMaxAge time.Duration `mapstructure:"media_max_age"` // 临时媒体文件超过该时长视为遗留
 }
 
 type LogConfig struct {
@@ -56,9 +64,19 @@ type ApiConfig struct {
 	Timeout   time.Duration   `mapstructure:"timeout"`
 	Retry     int             `mapstructure:"retry"`
 	Cookie    cookie          `mapstructure:"cookie"`
+	Pool      ClientPool      `mapstructure:"pool"`
+	Health    HealthCheck     `mapstructure:"health"`
 	RateLimit RateLimitConfig `mapstructure:"rateLimit"`
 }
 
+type ClientPool struct {
+	IdleTimeout time.Duration `mapstructure:"idle_timeout"` // 客户端空闲多久后关闭
+}
+
+type HealthCheck struct {
+	Interval time.Duration `mapstructure:"interval"` // 凭据登录状态检查间隔
+}
+
 type RateLimitConfig struct {
 	RequestsPerMinute int `mapstructure:"requestsPerMinute"`
 	BurstSize         int `mapstructure:"burstSize"`
@@ -91,10 +109,29 @@ type MusicConfig struct {
 }
 
 type SecurityConfig struct {
-	SessionSecret    string     `mapstructure:"session_secret"`
-	MaxFileSize      string     `mapstructure:"max_file_size"`
-	AllowedFileTypes []string   `mapstructure:"allowed_file_types"`
-	CORS             CORSConfig `mapstructure:"cors"`
+	SessionSecret    string           `mapstructure:"session_secret"`
+	MaxFileSize      string           `mapstructure:"max_file_size"`
+	AllowedFileTypes []string         `mapstructure:"allowed_file_types"`
+	CORS             CORSConfig       `mapstructure:"cors"`
+	Credential       CredentialConfig `mapstructure:"credential"`
+	Session          SessionConfig    `mapstructure:"session"`
+	CSRF             CSRFConfig       `mapstructure:"csrf"`
+}
+
+type CSRFConfig struct {
+	ExemptPaths     []string `mapstructure:"exempt_paths"`      // 不校验 CSRF token 的接口，相对于 /bvtc/api
+	TokenAuthExempt bool     `mapstructure:"token_auth_exempt"` // 使用 Bearer token 且不带会话 cookie 的请求不校验
+}
+
+type SessionConfig struct {
+	IdleTimeout     time.Duration `mapstructure:"idle_timeout"`     // 无访问多久后过期，每次访问滑动续期
+	AbsoluteTimeout time.Duration `mapstructure:"absolute_timeout"` // 登录后最长有效期，到期必须重新登录
+}
+
+type CredentialConfig struct {
+	Backend         string   `mapstructure:"backend"`          // 凭据存储：file（加密文件）或 redis
+	PreviousSecrets []string `mapstructure:"previous_secrets"` // 轮换前的 SESSION_SECRET，只用于解密
+	RuntimeDir      string   `mapstructure:"runtime_dir"`      // 客户端使用期间的解密文件目录，默认系统临时目录
 }
 
 type CORSConfig struct {
@@ -104,13 +141,35 @@ type CORSConfig struct {
 }
 
 type AIConfig struct {
-	Provider       string        `mapstructure:"provider"`
+	Provider       string        `mapstructure:"provider"` // ollama、openai（兼容 /v1/chat/completions）或 stub
 	BaseURL        string        `mapstructure:"base_url"`
 	Model          string        `mapstructure:"model"`
 	Timeout        time.Duration `mapstructure:"timeout"`
 	MaxTitleLength int           `mapstructure:"max_title_length"`
 	CacheTTL       time.Duration `mapstructure:"cache_ttl"`
 	Concurrency    int64         `mapstructure:"concurrency"`
+	APIKey         string        `mapstructure:"api_key"`        // openai 兼容服务的 API Key
+	Temperature    float64       `mapstructure:"temperature"`    // 采样温度
+	SystemPrompt   string        `mapstructure:"system_prompt"`  // 系统提示词，为空时使用默认值
+	CacheBackend   string        `mapstructure:"cache_backend"`  // 标题建议缓存：memory（进程内 LRU）或 redis
+	CacheSize      int           `mapstructure:"cache_size"`     // memory 缓存的最大条目数
+	RuleThreshold  float64       `mapstructure:"rule_threshold"` // 规则解析置信度不低于该值时不调用大模型
+	PromptFile     string        `mapstructure:"prompt_file"`    // 提示词模板文件（yaml/json），为空时使用内置模板
+	Fallbacks      []AIFallback  `mapstructure:"fallbacks"`      // 主 Provider 失败或熔断时按顺序尝试的备用 Provider
+	Breaker        AIBreaker     `mapstructure:"breaker"`        // 每个 Provider 的熔断参数
+}
+
+type AIFallback struct {
+	Provider  string        `mapstructure:"provider"`
+	BaseURL   string        `mapstructure:"base_url"`
+	Model     string        `mapstructure:"model"`
+	APIKeyEnv string        `mapstructure:"api_key_env"` // 存放 API Key 的环境变量名，避免把密钥写进配置文件
+	Timeout   time.Duration `mapstructure:"timeout"`     // 单次调用超时，0 时使用 Ai.timeout
+}
+
+type AIBreaker struct {
+	Failures int           `mapstructure:"failures"` // 连续失败多少次后熔断
+	Cooldown time.Duration `mapstructure:"cooldown"` // 熔断后多久放行一次探测请求
 }
 
 var c YamlConfig
@@ -119,14 +178,15 @@ func init() {
 	// Docker部署时不需要加载.env文件，因为通过环境变量传递配置,本地运行时需要添加
 	envPath := filepath.Join("..", ".env")
 	err := godotenv.Load(envPath)
-	if err != nil {
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
 		panic("fail to load .env file,err : " + err.Error())
 	}
 
 	// 配置 viper
-	viper.SetConfigName("conf")     // 配置文件名称（不带扩展名）
-	viper.SetConfigType("yaml")     // 配置文件类型
-	viper.AddConfigPath("./config") // 配置文件所在路径
+	viper.SetConfigName("conf")      // 配置文件名称（不带扩展名）
+	viper.SetConfigType("yaml")      // 配置文件类型
+	viper.AddConfigPath("./config")  // 配置文件所在路径
+	viper.AddConfigPath("../config") // 在子包目录中运行 go test 时
 
 	// 设置环境变量优先级
 	viper.AutomaticEnv()
@@ -172,6 +232,15 @@ func bindEnvVars() {
 	if err := viper.BindEnv("security.allowed_file_types", "ALLOWED_FILE_TYPES"); err != nil {
 		log.Printf("Failed to bind ALLOWED_FILE_TYPES: %v", err)
 	}
+	if err := viper.BindEnv("security.credential.backend", "CREDENTIAL_BACKEND"); err != nil {
+		log.Printf("Failed to bind CREDENTIAL_BACKEND: %v", err)
+	}
+	if err := viper.BindEnv("security.credential.previous_secrets", "CREDENTIAL_PREVIOUS_SECRETS"); err != nil {
+		log.Printf("Failed to bind CREDENTIAL_PREVIOUS_SECRETS: %v", err)
+	}
+	if err := viper.BindEnv("security.credential.runtime_dir", "CREDENTIAL_RUNTIME_DIR"); err != nil {
+		log.Printf("Failed to bind CREDENTIAL_RUNTIME_DIR: %v", err)
+	}
 	if err := viper.BindEnv("security.cors.allowed_origins", "CORS_ALLOWED_ORIGINS"); err != nil {
 		log.Printf("Failed to bind CORS_ALLOWED_ORIGINS: %v", err)
 	}
@@ -194,6 +263,9 @@ func bindEnvVars() {
 	if err := viper.BindEnv("api.cookie.interval", "NETEASE_API_COOKIE_INTERVAL"); err != nil {
 		log.Printf("Failed to bind NETEASE_API_COOKIE_INTERVAL: %v", err)
 	}
+	if err := viper.BindEnv("api.health.interval", "NETEASE_API_HEALTH_INTERVAL"); err != nil {
+		log.Printf("Failed to bind NETEASE_API_HEALTH_INTERVAL: %v", err)
+	}
 
 	// AI配置
 	if err := viper.BindEnv("ai.provider", "AI_PROVIDER"); err != nil {
@@ -217,6 +289,27 @@ func bindEnvVars() {
 	if err := viper.BindEnv("ai.concurrency", "AI_CONCURRENCY"); err != nil {
 		log.Printf("Failed to bind AI_CONCURRENCY: %v", err)
 	}
+	if err := viper.BindEnv("ai.api_key", "AI_API_KEY"); err != nil {
+		log.Printf("Failed to bind AI_API_KEY: %v", err)
+	}
+	if err := viper.BindEnv("ai.temperature", "AI_TEMPERATURE"); err != nil {
+		log.Printf("Failed to bind AI_TEMPERATURE: %v", err)
+	}
+	if err := viper.BindEnv("ai.system_prompt", "AI_SYSTEM_PROMPT"); err != nil {
+		log.Printf("Failed to bind AI_SYSTEM_PROMPT: %v", err)
+	}
+	if err := viper.BindEnv("ai.cache_backend", "AI_CACHE_BACKEND"); err != nil {
+		log.Printf("Failed to bind AI_CACHE_BACKEND: %v", err)
+	}
+	if err := viper.BindEnv("ai.prompt_file", "AI_PROMPT_FILE"); err != nil {
+		log.Printf("Failed to bind AI_PROMPT_FILE: %v", err)
+	}
+	if err := viper.BindEnv("ai.breaker.failures", "AI_BREAKER_FAILURES"); err != nil {
+		log.Printf("Failed to bind AI_BREAKER_FAILURES: %v", err)
+	}
+	if err := viper.BindEnv("ai.breaker.cooldown", "AI_BREAKER_COOLDOWN"); err != nil {
+		log.Printf("Failed to bind AI_BREAKER_COOLDOWN: %v", err)
+	}
 }
 
 // debugEnvVars 调试环境变量
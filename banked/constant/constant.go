@@ -20,6 +20,8 @@
 
 package constant
 
+import "time"
+
 const (
 	Filepath = "file"
 
@@ -30,4 +32,19 @@ const (
 	TaskStatusCompleted = "completed" // 已完成
 	TaskStatusFailed    = "failed"    // 失败
 	TaskStatusOuttime   = "outtime"   // 超时
+
+	ItemStatusSuccess = "success" // 单个视频处理成功
+	ItemStatusFailed  = "failed"  // 单个视频处理失败
+
+	SessionIdleTimeout     = 7 * 24 * time.Hour  // 默认会话空闲超时
+	SessionAbsoluteTimeout = 30 * 24 * time.Hour // 默认会话绝对超时
+
+	CodeReloginRequired = 4011 // 网易云登录已失效，需要重新登录
+
+	PlaylistPositionTop    = "top"    // 新歌曲插入歌单顶部
+	PlaylistPositionBottom = "bottom" // 新歌曲插入歌单底部
+
+	TitleModeOriginal       = "original"         // 使用视频原标题
+	TitleModeAI             = "ai"               // 使用 AI 生成的标题，生成失败时该视频失败
+	TitleModeAIWithFallback = "ai-with-fallback" // 使用 AI 生成的标题，生成失败时退回原标题
 )
\ No newline at end of file
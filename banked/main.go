@@ -31,11 +31,16 @@ import (
 
 	"bvtc/ai"
 	"bvtc/client"
+	"bvtc/cloudnet"
 	"bvtc/config"
+	"bvtc/constant"
 	"bvtc/log"
 	"bvtc/route"
 
+	"bvtc/tool/credential"
+	"bvtc/tool/janitor"
 	redis_pool "bvtc/tool/pool"
+	"bvtc/tool/session"
 	"bvtc/tool/socket"
 	"bvtc/tool/spew"
 )
@@ -54,6 +59,42 @@ func main() {
 	// 初始化redis
 	redis_pool.InitRedis()
 
+	// 初始化凭据存储，并加密/迁移旧的明文 cookie 文件
+	cfg := config.GetConfig()
+	if err := credential.Init(credential.Options{
+		Backend:         cfg.Security.Credential.Backend,
+		Secret:          cfg.Security.SessionSecret,
+		PreviousSecrets: cfg.Security.Credential.PreviousSecrets,
+		CookieDir:       cfg.Api.Cookie.Filepath,
+		RuntimeDir:      cfg.Security.Credential.RuntimeDir,
+		Redis:           redis_pool.GetRdb(),
+	}); err != nil {
+		panic("凭据存储初始化失败: " + err.Error())
+	}
+	if stats, err := credential.Migrate(); err != nil {
+		log.Logger.Error("credential migrate failed", log.Any("err", err))
+	} else {
+		log.Logger.Info("credential migrate finished", log.Any("stats", stats))
+	}
+
+	// 后台定期检查登录凭据，失效时标记会话并暂停任务；定期清理孤立凭据和临时文件
+	healthCtx, stopHealth := context.WithCancel(context.Background())
+	defer stopHealth()
+	go cloudnet.StartCredentialHealthCheck(healthCtx)
+	go janitor.Start(healthCtx, janitor.Options{
+		Interval:    cfg.Janitor.Interval,
+		MediaMaxAge: cfg.Janitor.MediaMaxAge,
+		MediaDir:    constant.Filepath,
+		References:  session.ReferencedCredentials,
+		OnCredentialRemoved: func(name string) {
+			_ = session.ClearCredentialExpired(name)
+		},
+	})
+
+	// 根据配置选择 AI Provider
+	if err := ai.InitProvider(); err != nil {
+		panic("AI 接口初始化失败: " + err.Error())
+	}
 	go ai.WarmupAITitle()
 	newRouter := route.NewRouter()
 	appPort := os.Getenv("APP_PORT")
@@ -91,6 +132,9 @@ func main() {
 		if err := socket.Shutdown(shutdownCtx); err != nil && !errors.Is(err, context.Canceled) {
 			log.Logger.Error("websocket manager shutdown failed", log.Any("err", err))
 		}
+		if err := client.ShutdownNetcloudPool(shutdownCtx); err != nil {
+			log.Logger.Error("netcloud client pool shutdown failed", log.Any("err", err))
+		}
 
 		if err := <-serverErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Logger.Error("server error", log.Any("serverError", err))
@@ -0,0 +1,77 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"bvtc/config"
+	"bvtc/log"
+	"bvtc/response"
+	"bvtc/tool/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 测试时替换，避免依赖 Redis
+var (
+	csrfConfig      = func() config.CSRFConfig { return config.GetConfig().Security.CSRF }
+	verifyCSRFToken = session.VerifyCSRFToken
+)
+
+// CSRFMiddleware 对非 GET 请求校验会话中的 CSRF token（synchronizer token）
+// basePath 为路由组前缀，配置中的豁免路径相对于该前缀
+func CSRFMiddleware(basePath string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		cfg := csrfConfig()
+		path := strings.TrimPrefix(c.FullPath(), basePath)
+		for _, exempt := range cfg.ExemptPaths {
+			if path == exempt {
+				c.Next()
+				return
+			}
+		}
+
+		sid, err := c.Cookie("SessionId")
+		// 使用 token 认证、不携带会话 cookie 的 API 客户端不受 CSRF 影响
+		if err != nil && cfg.TokenAuthExempt && strings.HasPrefix(c.GetHeader("Authorization"), "Bearer ") {
+			c.Next()
+			return
+		}
+
+		if err != nil || !verifyCSRFToken(sid, c.GetHeader(session.CSRFHeader)) {
+			log.Logger.Warn("CSRF check failed",
+				log.String("path", c.Request.URL.Path),
+				log.String("remote_addr", c.ClientIP()))
+			c.JSON(http.StatusForbidden, response.FailMsg("CSRF token 无效，请刷新页面后重试"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"bvtc/config"
+	"bvtc/log"
+	"bvtc/tool/session"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func newCSRFRouter(t *testing.T, cfg config.CSRFConfig) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	log.Logger = zap.NewNop()
+
+	oldConfig, oldVerify := csrfConfig, verifyCSRFToken
+	csrfConfig = func() config.CSRFConfig { return cfg }
+	verifyCSRFToken = func(sid string, token string) bool {
+		return sid == "sid-1" && token == "csrf-1"
+	}
+	t.Cleanup(func() { csrfConfig, verifyCSRFToken = oldConfig, oldVerify })
+
+	r := gin.New()
+	group := r.Group("/bvtc/api")
+	group.Use(CSRFMiddleware(group.BasePath()))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	group.GET("/netcloud/playlist", ok)
+	group.POST("/bilibili/createtask", ok)
+	group.POST("/netcloud/login/sms", ok)
+	return r
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	r := newCSRFRouter(t, config.CSRFConfig{
+		ExemptPaths:     []string{"/netcloud/login/sms"},
+		TokenAuthExempt: true,
+	})
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		sid    string
+		token  string
+		bearer bool
+		want   int
+	}{
+		{"get is not checked", http.MethodGet, "/netcloud/playlist", "", "", false, http.StatusOK},
+		{"exempt path", http.MethodPost, "/netcloud/login/sms", "", "", false, http.StatusOK},
+		{"valid token", http.MethodPost, "/bilibili/createtask", "sid-1", "csrf-1", false, http.StatusOK},
+		{"missing token", http.MethodPost, "/bilibili/createtask", "sid-1", "", false, http.StatusForbidden},
+		{"wrong token", http.MethodPost, "/bilibili/createtask", "sid-1", "csrf-2", false, http.StatusForbidden},
+		{"token of another session", http.MethodPost, "/bilibili/createtask", "sid-2", "csrf-1", false, http.StatusForbidden},
+		{"no session", http.MethodPost, "/bilibili/createtask", "", "csrf-1", false, http.StatusForbidden},
+		{"bearer without cookie", http.MethodPost, "/bilibili/createtask", "", "", true, http.StatusOK},
+		{"bearer with cookie is still checked", http.MethodPost, "/bilibili/createtask", "sid-1", "", true, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, "/bvtc/api"+tc.path, nil)
+		if tc.sid != "" {
+			req.AddCookie(&http.Cookie{Name: "SessionId", Value: tc.sid})
+		}
+		if tc.token != "" {
+			req.Header.Set(session.CSRFHeader, tc.token)
+		}
+		if tc.bearer {
+			req.Header.Set("Authorization", "Bearer bvtc_test")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, w.Code, tc.want)
+		}
+	}
+}
+
+func TestCSRFMiddlewareBearerNotExempt(t *testing.T) {
+	r := newCSRFRouter(t, config.CSRFConfig{})
+
+	req := httptest.NewRequest(http.MethodPost, "/bvtc/api/bilibili/createtask", nil)
+	req.Header.Set("Authorization", "Bearer bvtc_test")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("got %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
@@ -21,20 +21,43 @@
 package middleware
 
 import (
+	"bvtc/constant"
 	"bvtc/log"
 	"bvtc/response"
 	redis_pool "bvtc/tool/pool"
+	"bvtc/tool/session"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// SessionAuthMiddleware 验证session是否有效的中间件
-func SessionAuthMiddleware() gin.HandlerFunc {
+// 两次滑动续期之间的最小间隔，避免每个请求都写 Redis
+const sessionTouchInterval = time.Minute
+
+// 令牌认证依赖的会话操作，测试时替换，避免依赖 Redis
+var (
+	lookupAPIToken    = session.LookupAPIToken
+	cookieBySession   = session.GetCookieBySession
+	credentialExpired = session.CredentialExpired
+)
+
+// RouteScopes 允许个人访问令牌调用的接口及所需权限，key 为 "METHOD /path"，path 相对于路由组前缀
+type RouteScopes map[string]string
+
+// SessionAuthMiddleware 验证session是否有效的中间件，并对活跃会话滑动续期
+// 携带 Authorization: Bearer 的请求按个人访问令牌认证，只能调用 scopes 中列出的接口
+func SessionAuthMiddleware(basePath string, scopes RouteScopes) gin.HandlerFunc {
+	basePath = strings.TrimSuffix(basePath, "/")
 	return func(c *gin.Context) {
+		if raw, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+			tokenAuth(c, strings.TrimSpace(raw), scopes[c.Request.Method+" "+strings.TrimPrefix(c.FullPath(), basePath)])
+			return
+		}
+
 		sid, err := c.Cookie("SessionId")
 		if err != nil {
 			log.Logger.Info("Session check failed - no cookie",
@@ -46,7 +69,8 @@ func SessionAuthMiddleware() gin.HandlerFunc {
 		}
 
 		// 验证session是否有效
-		if !validateSession(sid) {
+		renew, ok := validateSession(sid)
+		if !ok {
 			log.Logger.Info("Session check failed - invalid session",
 				log.String("session_id", sid),
 				log.String("path", c.Request.URL.Path),
@@ -56,6 +80,26 @@ func SessionAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// 当前账号登录已失效：除账号管理和退出登录外都要求重新登录
+		if !reloginExempt(c.FullPath()) && session.CredentialExpired(session.GetCookieBySession(sid)) {
+			log.Logger.Info("Session check failed - relogin required",
+				log.String("session_id", sid),
+				log.String("path", c.Request.URL.Path))
+			c.JSON(http.StatusUnauthorized, response.FailCodeMsg(constant.CodeReloginRequired, "网易云登录已失效，请重新登录"))
+			c.Abort()
+			return
+		}
+
+		// 滑动续期：Redis 和浏览器 cookie 同步延长
+		if renew > 0 {
+			if err := session.Touch(sid, c.ClientIP(), renew); err != nil {
+				log.Logger.Warn("fail to renew session", log.String("session_id", sid), log.Any("err", err))
+			} else {
+				c.SetSameSite(http.SameSiteLaxMode)
+				c.SetCookie("SessionId", sid, int(renew.Seconds()), "/", "", true, true)
+			}
+		}
+
 		// 将session信息存储到上下文中，供后续处理使用
 		c.Set("session_id", sid)
 		// log.Logger.Info("Session check passed",
@@ -66,60 +110,139 @@ func SessionAuthMiddleware() gin.HandlerFunc {
 	}
 }
 
-// validateSession 验证session是否有效
-func validateSession(sessionID string) bool {
+// tokenAuth 个人访问令牌认证，通过后把令牌会话作为 SessionId 交给后续处理函数
+func tokenAuth(c *gin.Context, raw string, scope string) {
+	tok, err := lookupAPIToken(raw)
+	if err != nil {
+		log.Logger.Info("Token check failed",
+			log.String("path", c.Request.URL.Path),
+			log.String("remote_addr", c.ClientIP()),
+			log.Any("err", err))
+		c.JSON(http.StatusUnauthorized, response.FailMsg("令牌无效或已过期"))
+		c.Abort()
+		return
+	}
+	if scope == "" || !tok.HasScope(scope) {
+		log.Logger.Info("Token check failed - insufficient scope",
+			log.String("token_id", tok.Id),
+			log.String("path", c.Request.URL.Path),
+			log.String("scope", scope))
+		c.JSON(http.StatusForbidden, response.FailMsg("令牌没有该接口的权限"))
+		c.Abort()
+		return
+	}
+	cookieFile := cookieBySession(tok.Sid)
+	if cookieFile == "" {
+		c.JSON(http.StatusUnauthorized, response.FailMsg("令牌无效或已过期"))
+		c.Abort()
+		return
+	}
+	if credentialExpired(cookieFile) {
+		c.JSON(http.StatusUnauthorized, response.FailCodeMsg(constant.CodeReloginRequired, "网易云登录已失效，请重新登录后重新生成令牌"))
+		c.Abort()
+		return
+	}
+
+	// 处理函数统一从 SessionId cookie 读取会话，这里替换为令牌会话
+	c.Request.Header.Del("Cookie")
+	c.Request.AddCookie(&http.Cookie{Name: "SessionId", Value: tok.Sid})
+	c.Set("session_id", tok.Sid)
+	c.Set("api_token_id", tok.Id)
+	c.Next()
+}
+
+// 登录失效时仍允许访问的接口：切换/关联账号、设备管理和退出登录
+var reloginExemptPaths = []string{
+	"/netcloud/accounts",
+	"/netcloud/sessions",
+	"/netcloud/logout",
+	"/bilibili/login",
+}
+
+func reloginExempt(fullPath string) bool {
+	for _, p := range reloginExemptPaths {
+		if strings.Contains(fullPath, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSession 验证session是否有效，renew 大于 0 时表示需要续期到该时长
+func validateSession(sessionID string) (renew time.Duration, ok bool) {
 	rdb := redis_pool.GetRdb()
 	rtcx := redis_pool.GetRctx()
 	key := "session:" + sessionID
 
-	// 检查session是否存在
-	exists, err := rdb.Exists(rtcx, key).Result()
+	// 检查session是否存在（Redis会自动处理空闲过期）
+	fields, err := rdb.HGetAll(rtcx, key).Result()
 	if err != nil {
 		log.Logger.Error("Redis error checking session",
 			log.String("session_id", sessionID),
 			log.String("error", err.Error()))
-		return false
+		return 0, false
 	}
-	if exists == 0 {
+	if len(fields) == 0 {
 		log.Logger.Info("Session not found in Redis",
 			log.String("session_id", sessionID))
-		return false
+		return 0, false
 	}
 
-	// 检查session是否过期（Redis会自动处理过期）
-	// 额外检查创建时间，确保session不会无限期有效
-	createdAt, err := rdb.HGet(rtcx, key, "createdAt").Result()
-	if err != nil {
-		return false
+	// 检查session是否被标记为无效
+	if fields["isValid"] == "false" {
+		log.Logger.Info("Session marked as invalid",
+			log.String("session_id", sessionID))
+		return 0, false
 	}
 
 	// 解析创建时间 - 改进时间解析逻辑
-	createTime, err := parseTime(createdAt)
+	createTime, err := parseTime(fields["createdAt"])
 	if err != nil {
-		return false
+		return 0, false
 	}
 
-	// 检查session是否超过7天
-	if time.Since(createTime) > 7*24*time.Hour {
+	// 绝对超时：无论是否活跃，到期都必须重新登录
+	absolute := redis_pool.SessionAbsoluteTimeout()
+	if time.Since(createTime) > absolute {
 		// 删除过期的session
 		rdb.Del(rtcx, key)
 		log.Logger.Info("Session expired and deleted",
 			log.String("session_id", sessionID),
-			log.String("created_at", createdAt))
-		return false
+			log.String("created_at", fields["createdAt"]))
+		return 0, false
 	}
 
-	// 检查session是否被标记为无效
-	isValid, err := rdb.HGet(rtcx, key, "isValid").Result()
-	if err == nil && isValid == "false" {
-		log.Logger.Info("Session marked as invalid",
-			log.String("session_id", sessionID))
-		return false
+	// 没有访问记录的会话：登录尚未完成（短期会话）时不续期
+	lastSeen := createTime
+	if fields["lastSeenAt"] == "" {
+		ttl, err := rdb.TTL(rtcx, key).Result()
+		if err != nil || ttl <= 10*time.Minute {
+			return 0, true
+		}
+	} else if t, err := parseTime(fields["lastSeenAt"]); err == nil {
+		lastSeen = t
+	}
+
+	idle := redis_pool.SessionIdleTimeout()
+	if time.Since(lastSeen) > idle {
+		rdb.Del(rtcx, key)
+		log.Logger.Info("Session idle timeout",
+			log.String("session_id", sessionID),
+			log.String("last_seen_at", fields["lastSeenAt"]))
+		return 0, false
+	}
+	if fields["lastSeenAt"] != "" && time.Since(lastSeen) < sessionTouchInterval {
+		return 0, true
 	}
 
+	// 续期时长不超过绝对超时的剩余时间
+	renew = idle
+	if remaining := absolute - time.Since(createTime); remaining < renew {
+		renew = remaining
+	}
 	// log.Logger.Info("Session validation successful",
 	// 	log.String("session_id", sessionID))
-	return true
+	return renew, true
 }
 
 // parseTime 改进的时间解析函数
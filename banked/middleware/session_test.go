@@ -0,0 +1,95 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"bvtc/log"
+	"bvtc/tool/session"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func TestTokenAuthRouteScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	log.Logger = zap.NewNop()
+
+	oldLookup, oldCookie, oldExpired := lookupAPIToken, cookieBySession, credentialExpired
+	t.Cleanup(func() { lookupAPIToken, cookieBySession, credentialExpired = oldLookup, oldCookie, oldExpired })
+	lookupAPIToken = func(raw string) (*session.APIToken, error) {
+		switch raw {
+		case "bvtc_read":
+			return &session.APIToken{Id: "t1", Sid: "token-sid", Scopes: []string{session.ScopeTasksRead}}, nil
+		case "bvtc_expired":
+			return &session.APIToken{Id: "t2", Sid: "expired-sid", Scopes: []string{session.ScopeTasksRead}}, nil
+		}
+		return nil, session.ErrAPITokenNotFound
+	}
+	cookieBySession = func(sid string) string { return sid + ".json" }
+	credentialExpired = func(cookieFile string) bool { return cookieFile == "expired-sid.json" }
+
+	r := gin.New()
+	group := r.Group("/bvtc/api")
+	group.Use(SessionAuthMiddleware(group.BasePath(), RouteScopes{
+		"GET /bilibili/checktask/:taskId": session.ScopeTasksRead,
+		"POST /bilibili/createtask":       session.ScopeTasksCreate,
+	}))
+	handler := func(c *gin.Context) {
+		sid, _ := c.Cookie("SessionId")
+		c.String(http.StatusOK, sid)
+	}
+	group.GET("/bilibili/checktask/:taskId", handler)
+	group.POST("/bilibili/createtask", handler)
+	group.GET("/netcloud/tokens", handler)
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"scope granted", http.MethodGet, "/bilibili/checktask/abc", "bvtc_read", http.StatusOK},
+		{"scope missing", http.MethodPost, "/bilibili/createtask", "bvtc_read", http.StatusForbidden},
+		{"route not open to tokens", http.MethodGet, "/netcloud/tokens", "bvtc_read", http.StatusForbidden},
+		{"unknown token", http.MethodGet, "/bilibili/checktask/abc", "bvtc_nope", http.StatusUnauthorized},
+		{"credential expired", http.MethodGet, "/bilibili/checktask/abc", "bvtc_expired", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, "/bvtc/api"+tc.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		// 令牌请求中的浏览器会话 cookie 必须被替换
+		req.AddCookie(&http.Cookie{Name: "SessionId", Value: "browser-sid"})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, w.Code, tc.want)
+			continue
+		}
+		if tc.want == http.StatusOK && w.Body.String() != "token-sid" {
+			t.Errorf("%s: handler saw session %q, want token-sid", tc.name, w.Body.String())
+		}
+	}
+}
@@ -33,6 +33,8 @@ import (
 	"bvtc/log"
 	"bvtc/middleware"
 	"bvtc/response"
+	"bvtc/tool/janitor"
+	"bvtc/tool/session"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -87,15 +89,28 @@ func setTrustedProxies(server *gin.Engine) {
 	}
 }
 
+// 个人访问令牌可以调用的接口，其余需要认证的接口只接受浏览器会话
+var tokenScopes = middleware.RouteScopes{
+	"POST /bilibili/createtask":         session.ScopeTasksCreate,
+	"GET /bilibili/list":                session.ScopeTasksRead,
+	"GET /bilibili/checktask/:taskId":   session.ScopeTasksRead,
+	"GET /bilibili/task/:taskId/report": session.ScopeTasksRead,
+	"GET /netcloud/playlist":            session.ScopePlaylistsRead,
+	"GET /netcloud/playlist/:pid":       session.ScopePlaylistsRead,
+}
+
 // registerRoutes 注册所有API路由
 func registerRoutes(group *gin.RouterGroup) {
+	// 所有非 GET 接口校验 CSRF token
+	group.Use(middleware.CSRFMiddleware(group.BasePath()))
+
 	// 公开接口（不需要认证）
-	// 验证码风控，转用二维码登录
-	// group.POST("/netcloud/login", cloudnet.SendByPhone)          // 发送验证码
-	// group.POST("/netcloud/login/verify", cloudnet.VerifyCaptcha) // 验证验证码
-	group.GET("/netcloud/login", cloudnet.GetLoginQrcode)          // 获取二维码
-	group.GET("/netcloud/login/verify", cloudnet.CheckLoginQrcode) // 验证二维码状态
-	group.GET("/netcloud/login/check", cloudnet.CheckCookie)       // 检查登陆状态
+	group.GET("/netcloud/login", cloudnet.GetLoginQrcode)            // 获取二维码
+	group.GET("/netcloud/login/verify", cloudnet.CheckLoginQrcode)   // 验证二维码状态
+	group.GET("/netcloud/login/check", cloudnet.CheckCookie)         // 检查登陆状态
+	group.POST("/netcloud/login/sms", cloudnet.SendByPhone)          // 发送短信验证码（被风控时返回验证步骤）
+	group.POST("/netcloud/login/sms/verify", cloudnet.VerifyCaptcha) // 短信验证码登录
+	group.POST("/netcloud/login/password", cloudnet.PasswordLogin)   // 手机号/邮箱 + 密码登录
 
 	// 测试接口
 	group.GET("/test/bilibili/download", bilibili.DownloadVideo)
@@ -103,19 +118,38 @@ func registerRoutes(group *gin.RouterGroup) {
 
 	// 需要认证的接口
 	authGroup := group.Group("/")
-	authGroup.Use(middleware.SessionAuthMiddleware())
+	authGroup.Use(middleware.SessionAuthMiddleware(group.BasePath(), tokenScopes))
 	{
-		authGroup.POST("/netcloud/logout", cloudnet.DeleteCookie)     // 退出登录,删除状态（改为POST防CSRF）
-		authGroup.GET("/netcloud/playlist", cloudnet.ShowPlaylist)    // 获取歌单
-		authGroup.GET("/netcloud/useravatar", cloudnet.GetUserAvatar) // 获取用户头像
+		authGroup.POST("/netcloud/logout", cloudnet.DeleteCookie)                        // 退出登录,删除状态（改为POST防CSRF）
+		authGroup.GET("/netcloud/playlist", cloudnet.ShowPlaylist)                       // 获取歌单
+		authGroup.GET("/netcloud/playlist/:pid", cloudnet.ShowPlaylistDetail)            // 获取歌单详情
+		authGroup.GET("/netcloud/useravatar", cloudnet.GetUserAvatar)                    // 获取用户头像
+		authGroup.GET("/netcloud/accounts", cloudnet.ListAccounts)                       // 关联账号列表
+		authGroup.POST("/netcloud/accounts/select", cloudnet.SelectAccount)              // 切换当前账号
+		authGroup.POST("/netcloud/accounts/remove", cloudnet.RemoveAccount)              // 取消关联账号
+		authGroup.GET("/netcloud/accounts/link", cloudnet.GetLinkAccountQrcode)          // 关联新账号二维码
+		authGroup.GET("/netcloud/accounts/link/verify", cloudnet.CheckLinkAccountQrcode) // 关联新账号扫码状态
+		authGroup.GET("/netcloud/sessions", cloudnet.ListSessions)                       // 当前账号的登录设备
+		authGroup.POST("/netcloud/sessions/revoke", cloudnet.RevokeSession)              // 撤销某个会话
+		authGroup.POST("/netcloud/sessions/revoke-all", cloudnet.RevokeAllSessions)      // 撤销所有其他会话
+		authGroup.GET("/netcloud/tokens", cloudnet.ListTokens)                           // 个人访问令牌列表
+		authGroup.POST("/netcloud/tokens", cloudnet.CreateToken)                         // 生成个人访问令牌
+		authGroup.POST("/netcloud/tokens/revoke", cloudnet.RevokeToken)                  // 撤销个人访问令牌
 
 		authGroup.POST("/bilibili/createtask", bilibili.CreateLoadMP4Task)                     // 创建任务
 		authGroup.GET("/bilibili/checktask/:taskId", bilibili.CheckLoadMP4Task)                // 查询任务状态
+		authGroup.GET("/bilibili/task/:taskId/report", bilibili.DownloadTaskReport)            // 下载任务报告（json/csv）
 		authGroup.GET("/bilibili/list", bilibili.GetVideoList)                                 // 视频列表
 		authGroup.GET("/bilibili/suggest-title-batch/stream", routeai.SuggestTitleBatchStream) // 生成标题（SSE流式）
-		// 暂时不用下面接口
-		authGroup.GET("/bilibili/login", bilibili.BiliLogin)
-		authGroup.GET("/bilibili/login/check", bilibili.BiliLoginWithCookie)
+		authGroup.POST("/bilibili/suggest-title/invalidate", routeai.InvalidateSuggestions)    // 清除标题建议缓存（重新生成）
+		authGroup.GET("/bilibili/login", bilibili.BiliLogin)                                   // 哔哩哔哩登录二维码
+		authGroup.GET("/bilibili/login/verify", bilibili.BiliLoginCheck)                       // 哔哩哔哩扫码状态（websocket）
+		authGroup.GET("/bilibili/login/check", bilibili.BiliLoginStatus)                       // 哔哩哔哩登录状态
+		authGroup.POST("/bilibili/logout", bilibili.BiliLogout)                                // 退出哔哩哔哩登录
+
+		authGroup.GET("/ai/status", routeai.AIStatus)       // AI 子系统状态
+		authGroup.POST("/ai/warmup", routeai.TriggerWarmup) // 重新触发模型预热
+		authGroup.GET("/ai/models", routeai.ModelStatus)    // 检查 Ollama 模型是否已拉取
 	}
 }
 
@@ -168,11 +202,11 @@ func Cors() gin.HandlerFunc {
 			// 使用配置文件中的头部，如果没有配置则使用默认值
 			allowedHeaders := config.GetConfig().Security.CORS.AllowedHeaders
 			if len(allowedHeaders) == 0 {
-				allowedHeaders = []string{"Content-Type", "Authorization", "X-Requested-With"}
+				allowedHeaders = []string{"Content-Type", "Authorization", "X-Requested-With", "X-CSRF-Token"}
 			}
 			c.Header("Access-Control-Allow-Headers", strings.Join(allowedHeaders, ", "))
 
-			c.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers")
+			c.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers, X-CSRF-Token")
 			c.Header("Access-Control-Allow-Credentials", "true")
 			c.Header("Access-Control-Max-Age", "3600") // 1小时
 		}
@@ -209,5 +243,9 @@ func Recovery(c *gin.Context) {
 
 // HealthCheck 健康检查处理函数
 func HealthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, response.SuccessMsg("Server is healthy"))
+	c.JSON(http.StatusOK, response.SuccessMsg(gin.H{
+		"status":  "Server is healthy",
+		"janitor": janitor.GetStats(),
+		"ai":      routeai.ProviderStatus(),
+	}))
 }
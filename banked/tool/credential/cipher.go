@@ -0,0 +1,153 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package credential
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// 加密后的格式：bvtc-cred:v1:<keyID>:<base64(nonce+密文)>
+const envelopePrefix = "bvtc-cred:v1:"
+
+// 派生密钥时使用的 info，修改后所有已有凭据都无法解密
+const keyInfo = "bvtc credential store v1"
+
+var errUnknownKey = errors.New("credential encrypted with unknown key")
+
+type aeadKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// keyring 当前密钥用于加密，历史密钥只用于解密，支持密钥轮换
+type keyring struct {
+	primary aeadKey
+	keys    map[string]aeadKey
+}
+
+// deriveKey 通过 HKDF-SHA256 从 SESSION_SECRET 派生 AES-256 密钥
+func deriveKey(secret string) (aeadKey, error) {
+	raw, err := hkdf.Key(sha256.New, []byte(secret), nil, keyInfo, 32)
+	if err != nil {
+		return aeadKey{}, err
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return aeadKey{}, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return aeadKey{}, err
+	}
+	sum := sha256.Sum256(raw)
+	return aeadKey{id: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+func newKeyring(current string, previous []string) (*keyring, error) {
+	if current == "" {
+		return nil, errors.New("SESSION_SECRET is required to encrypt credentials")
+	}
+	primary, err := deriveKey(current)
+	if err != nil {
+		return nil, err
+	}
+	kr := &keyring{primary: primary, keys: map[string]aeadKey{primary.id: primary}}
+	for _, secret := range previous {
+		if secret == "" {
+			continue
+		}
+		k, err := deriveKey(secret)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := kr.keys[k.id]; !ok {
+			kr.keys[k.id] = k
+		}
+	}
+	return kr, nil
+}
+
+// seal 使用当前密钥加密，name 作为附加数据，防止不同账号的密文被互相替换
+func (kr *keyring) seal(name string, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, kr.primary.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := kr.primary.aead.Seal(nonce, nonce, plaintext, []byte(name))
+
+	var buf bytes.Buffer
+	buf.WriteString(envelopePrefix)
+	buf.WriteString(kr.primary.id)
+	buf.WriteByte(':')
+	buf.WriteString(base64.StdEncoding.EncodeToString(sealed))
+	return buf.Bytes(), nil
+}
+
+// open 解密凭据；stale 为 true 表示需要用当前密钥重新加密（旧明文文件或历史密钥）
+func (kr *keyring) open(name string, blob []byte) (plaintext []byte, stale bool, err error) {
+	if !isEnvelope(blob) {
+		// 迁移前的明文 cookie 文件
+		if len(bytes.TrimSpace(blob)) == 0 {
+			return []byte("{}"), true, nil
+		}
+		if !json.Valid(blob) {
+			return nil, false, fmt.Errorf("credential %s is neither encrypted nor valid json", name)
+		}
+		return blob, true, nil
+	}
+
+	rest := blob[len(envelopePrefix):]
+	sep := bytes.IndexByte(rest, ':')
+	if sep <= 0 {
+		return nil, false, fmt.Errorf("credential %s has malformed envelope", name)
+	}
+	k, ok := kr.keys[string(rest[:sep])]
+	if !ok {
+		return nil, false, errUnknownKey
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(rest[sep+1:]))
+	if err != nil {
+		return nil, false, fmt.Errorf("credential %s has malformed envelope: %w", name, err)
+	}
+	nonceSize := k.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, false, fmt.Errorf("credential %s has malformed envelope", name)
+	}
+	plaintext, err = k.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(name))
+	if err != nil {
+		return nil, false, fmt.Errorf("fail to decrypt credential %s: %w", name, err)
+	}
+	return plaintext, k.id != kr.primary.id, nil
+}
+
+func isEnvelope(blob []byte) bool {
+	return bytes.HasPrefix(blob, []byte(envelopePrefix))
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package credential
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestKeyringSealOpen(t *testing.T) {
+	kr, err := newKeyring("current-secret", nil)
+	if err != nil {
+		t.Fatalf("new keyring failed: %v", err)
+	}
+
+	plaintext := []byte(`{"MUSIC_U":"abc"}`)
+	blob, err := kr.seal("a.json", plaintext)
+	if err != nil {
+		t.Fatalf("seal failed: %v", err)
+	}
+	if bytes.Contains(blob, []byte("MUSIC_U")) {
+		t.Fatalf("sealed blob contains plaintext: %s", blob)
+	}
+
+	got, stale, err := kr.open("a.json", blob)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	if stale {
+		t.Errorf("blob sealed with primary key should not be stale")
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("open = %s, want %s", got, plaintext)
+	}
+
+	// 密文绑定凭据名，不能挪给其他账号使用
+	if _, _, err := kr.open("b.json", blob); err == nil {
+		t.Errorf("open with another name should fail")
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	old, err := newKeyring("old-secret", nil)
+	if err != nil {
+		t.Fatalf("new keyring failed: %v", err)
+	}
+	blob, err := old.seal("a.json", []byte(`{}`))
+	if err != nil {
+		t.Fatalf("seal failed: %v", err)
+	}
+
+	rotated, err := newKeyring("new-secret", []string{"old-secret"})
+	if err != nil {
+		t.Fatalf("new keyring failed: %v", err)
+	}
+	if _, stale, err := rotated.open("a.json", blob); err != nil || !stale {
+		t.Errorf("open with previous key = stale %v, err %v; want stale true, err nil", stale, err)
+	}
+
+	withoutOld, err := newKeyring("new-secret", nil)
+	if err != nil {
+		t.Fatalf("new keyring failed: %v", err)
+	}
+	if _, _, err := withoutOld.open("a.json", blob); err != errUnknownKey {
+		t.Errorf("open without previous key err = %v, want %v", err, errUnknownKey)
+	}
+}
+
+func TestKeyringOpenLegacyPlaintext(t *testing.T) {
+	kr, err := newKeyring("current-secret", nil)
+	if err != nil {
+		t.Fatalf("new keyring failed: %v", err)
+	}
+
+	got, stale, err := kr.open("a.json", []byte(`{"MUSIC_U":"abc"}`))
+	if err != nil || !stale || string(got) != `{"MUSIC_U":"abc"}` {
+		t.Errorf("open legacy = %s, stale %v, err %v", got, stale, err)
+	}
+	if _, _, err := kr.open("a.json", []byte("not json")); err == nil {
+		t.Errorf("open garbage should fail")
+	}
+}
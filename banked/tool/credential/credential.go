@@ -0,0 +1,291 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package credential 保存网易云登录 cookie，数据在落盘或写入 Redis 前使用 AES-GCM 加密。
+// 网易云客户端只能读写 cookie 文件，因此使用期间会把凭据解密到运行时目录，
+// 客户端关闭时再加密写回存储并删除运行时文件。
+package credential
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"bvtc/log"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type vault struct {
+	store      Store
+	keys       *keyring
+	cookieDir  string
+	runtimeDir string
+
+	mu   sync.Mutex
+	refs map[string]int // 运行时文件的使用数量
+}
+
+var (
+	defaultVault *vault
+	initOnce     sync.Once
+	initErr      error
+)
+
+// Options 凭据存储配置
+type Options struct {
+	Backend         string        // file 或 redis，默认 file
+	Secret          string        // 当前 SESSION_SECRET，用于派生加密密钥
+	PreviousSecrets []string      // 轮换前的密钥，只用于解密
+	CookieDir       string        // cookie 文件目录，file 后端的存储目录，也是迁移的来源
+	RuntimeDir      string        // 解密后的运行时文件目录，默认系统临时目录
+	Redis           *redis.Client // redis 后端使用
+}
+
+// Init 初始化凭据存储，Redis 后端需要在 Redis 初始化之后调用
+func Init(opts Options) error {
+	initOnce.Do(func() {
+		v, err := newVault(opts)
+		if err != nil {
+			initErr = err
+			return
+		}
+		defaultVault = v
+	})
+	return initErr
+}
+
+func newVault(opts Options) (*vault, error) {
+	keys, err := newKeyring(opts.Secret, opts.PreviousSecrets)
+	if err != nil {
+		return nil, err
+	}
+
+	var store Store
+	switch opts.Backend {
+	case "", BackendFile:
+		store = &fileStore{dir: filepath.Clean(opts.CookieDir)}
+	case BackendRedis:
+		if opts.Redis == nil {
+			return nil, errors.New("redis client is nil")
+		}
+		store = &redisStore{rdb: opts.Redis, prefix: "credential:"}
+	default:
+		return nil, fmt.Errorf("unknown credential backend %q", opts.Backend)
+	}
+
+	runtimeDir := opts.RuntimeDir
+	if runtimeDir == "" {
+		runtimeDir = filepath.Join(os.TempDir(), "bvtc-credentials")
+	}
+	if err := os.MkdirAll(runtimeDir, 0o700); err != nil {
+		return nil, fmt.Errorf("fail to create credential runtime dir: %w", err)
+	}
+
+	return &vault{
+		store:      store,
+		keys:       keys,
+		cookieDir:  filepath.Clean(opts.CookieDir),
+		runtimeDir: runtimeDir,
+		refs:       make(map[string]int),
+	}, nil
+}
+
+func get() (*vault, error) {
+	if defaultVault == nil {
+		return nil, errors.New("credential store not initialized")
+	}
+	return defaultVault, nil
+}
+
+// Get 读取并解密凭据；旧明文或历史密钥加密的凭据会顺便用当前密钥重新加密
+func Get(name string) ([]byte, error) {
+	v, err := get()
+	if err != nil {
+		return nil, err
+	}
+	blob, err := v.store.Load(name)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, stale, err := v.keys.open(name, blob)
+	if err != nil {
+		return nil, err
+	}
+	if stale {
+		if err := Put(name, plaintext); err != nil {
+			log.Logger.Warn("fail to re-encrypt credential", log.String("name", name), log.Any("err", err))
+		}
+	}
+	return plaintext, nil
+}
+
+// Put 加密并保存凭据
+func Put(name string, plaintext []byte) error {
+	v, err := get()
+	if err != nil {
+		return err
+	}
+	blob, err := v.keys.seal(name, plaintext)
+	if err != nil {
+		return err
+	}
+	return v.store.Save(name, blob)
+}
+
+// Exists 凭据是否存在
+func Exists(name string) bool {
+	v, err := get()
+	if err != nil {
+		return false
+	}
+	_, err = v.store.Load(name)
+	return err == nil
+}
+
+// Delete 删除凭据及其运行时文件，退出登录时调用
+func Delete(name string) error {
+	v, err := get()
+	if err != nil {
+		return err
+	}
+	v.mu.Lock()
+	delete(v.refs, name)
+	v.mu.Unlock()
+	if err := os.Remove(v.runtimePath(name)); err != nil && !os.IsNotExist(err) {
+		log.Logger.Warn("fail to remove credential runtime file", log.String("name", name), log.Any("err", err))
+	}
+	return v.store.Delete(name)
+}
+
+// Names 列出存储中的所有凭据
+func Names() ([]string, error) {
+	v, err := get()
+	if err != nil {
+		return nil, err
+	}
+	return v.store.List()
+}
+
+func (v *vault) runtimePath(name string) string {
+	return filepath.Join(v.runtimeDir, filepath.Base(name))
+}
+
+// Materialize 把凭据解密到运行时文件并返回路径，供网易云客户端读写。
+// 同一凭据已在使用时直接复用运行时文件，其中的 cookie 最新。每次调用都要对应一次 Seal。
+func Materialize(name string) (string, error) {
+	v, err := get()
+	if err != nil {
+		return "", err
+	}
+	path := v.runtimePath(name)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.refs[name] > 0 {
+		v.refs[name]++
+		return path, nil
+	}
+
+	plaintext, err := Get(name)
+	if errors.Is(err, ErrNotFound) {
+		plaintext = []byte("{}")
+	} else if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, plaintext, 0o600); err != nil {
+		return "", fmt.Errorf("fail to write credential runtime file: %w", err)
+	}
+	v.refs[name] = 1
+	return path, nil
+}
+
+// Seal 客户端关闭后调用：把运行时文件加密写回存储，最后一个使用者负责删除运行时文件
+func Seal(name string) error {
+	v, err := get()
+	if err != nil {
+		return err
+	}
+	path := v.runtimePath(name)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.refs[name] <= 0 {
+		// 已经被删除（退出登录）或从未解密过
+		return nil
+	}
+
+	// 写回失败也要归还引用并删除运行时文件，不能让明文 cookie 留在磁盘上
+	var sealErr error
+	if plaintext, err := os.ReadFile(path); err != nil {
+		sealErr = fmt.Errorf("fail to read credential runtime file: %w", err)
+	} else if err := Put(name, plaintext); err != nil {
+		sealErr = err
+	}
+
+	v.refs[name]--
+	if v.refs[name] <= 0 {
+		delete(v.refs, name)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) && sealErr == nil {
+			sealErr = err
+		}
+	}
+	return sealErr
+}
+
+// InUse 凭据是否正被客户端使用（已解密到运行时文件）
+func InUse(name string) bool {
+	v, err := get()
+	if err != nil {
+		return false
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.refs[name] > 0
+}
+
+// PruneRuntime 删除没有客户端在用的运行时文件（进程崩溃时遗留的明文 cookie），返回删除数量
+func PruneRuntime() (int, error) {
+	v, err := get()
+	if err != nil {
+		return 0, err
+	}
+	entries, err := os.ReadDir(v.runtimeDir)
+	if err != nil {
+		return 0, err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	removed := 0
+	for _, e := range entries {
+		if !e.Type().IsRegular() || v.refs[e.Name()] > 0 {
+			continue
+		}
+		if err := os.Remove(filepath.Join(v.runtimeDir, e.Name())); err != nil && !os.IsNotExist(err) {
+			log.Logger.Warn("fail to remove credential runtime file", log.String("name", e.Name()), log.Any("err", err))
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package credential
+
+import (
+	"errors"
+	"os"
+
+	"bvtc/log"
+)
+
+// MigrateStats 启动迁移的统计
+type MigrateStats struct {
+	Encrypted int // 明文 cookie 文件加密
+	Imported  int // 本地 cookie 文件导入 Redis
+	Rotated   int // 用当前密钥重新加密
+	Failed    int
+}
+
+// Migrate 启动时执行：加密旧的明文 cookie 文件，Redis 后端时导入本地文件，并用当前密钥重新加密所有凭据。
+// 可以重复执行。
+func Migrate() (MigrateStats, error) {
+	var stats MigrateStats
+	v, err := get()
+	if err != nil {
+		return stats, err
+	}
+
+	// Redis 后端：把 cookie 目录中的文件导入 Redis，导入成功后删除本地文件
+	if _, ok := v.store.(*redisStore); ok {
+		local := &fileStore{dir: v.cookieDir}
+		names, err := local.List()
+		if err != nil {
+			return stats, err
+		}
+		for _, name := range names {
+			if err := importFile(v, local, name); err != nil {
+				log.Logger.Error("fail to import credential", log.String("name", name), log.Any("err", err))
+				stats.Failed++
+				continue
+			}
+			stats.Imported++
+		}
+	}
+
+	names, err := v.store.List()
+	if err != nil {
+		return stats, err
+	}
+	for _, name := range names {
+		blob, err := v.store.Load(name)
+		if err != nil {
+			stats.Failed++
+			continue
+		}
+		plaintext, stale, err := v.keys.open(name, blob)
+		if err != nil {
+			log.Logger.Error("fail to open credential", log.String("name", name), log.Any("err", err))
+			stats.Failed++
+			continue
+		}
+		if !stale {
+			continue
+		}
+		if err := Put(name, plaintext); err != nil {
+			log.Logger.Error("fail to re-encrypt credential", log.String("name", name), log.Any("err", err))
+			stats.Failed++
+			continue
+		}
+		if isEnvelope(blob) {
+			stats.Rotated++
+		} else {
+			stats.Encrypted++
+		}
+	}
+	return stats, nil
+}
+
+func importFile(v *vault, local *fileStore, name string) error {
+	blob, err := local.Load(name)
+	if err != nil {
+		return err
+	}
+	plaintext, _, err := v.keys.open(name, blob)
+	if err != nil {
+		return err
+	}
+	// Redis 中已有时以 Redis 为准，只删除本地文件
+	if _, err := v.store.Load(name); errors.Is(err, ErrNotFound) {
+		if err := Put(name, plaintext); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(local.path(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package credential
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrNotFound 凭据不存在
+var ErrNotFound = errors.New("credential not found")
+
+// Store 凭据存储后端，只保存加密后的数据
+type Store interface {
+	Load(name string) ([]byte, error)
+	Save(name string, blob []byte) error
+	Delete(name string) error
+	List() ([]string, error)
+}
+
+// 存储后端
+const (
+	BackendFile  = "file"
+	BackendRedis = "redis"
+)
+
+// 匿名客户端使用的默认 cookie 文件，不属于任何用户，不加密
+const anonymousCookieFile = "cookie.json"
+
+// fileStore 加密文件存储，沿用原来的 cookie 目录和文件名
+type fileStore struct {
+	dir string
+}
+
+func (s *fileStore) path(name string) string {
+	return filepath.Join(s.dir, filepath.Base(name))
+}
+
+func (s *fileStore) Load(name string) ([]byte, error) {
+	b, err := os.ReadFile(s.path(name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return b, err
+}
+
+// Save 先写临时文件再重命名，避免写到一半的凭据
+func (s *fileStore) Save(name string, blob []byte) error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".cred-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(blob); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(name))
+}
+
+func (s *fileStore) Delete(name string) error {
+	if err := os.Remove(s.path(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *fileStore) List() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		if !e.Type().IsRegular() || !strings.HasSuffix(name, ".json") || name == anonymousCookieFile {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// redisStore 加密后存入 Redis，多个后端实例可以共享登录状态
+type redisStore struct {
+	rdb    *redis.Client
+	prefix string
+}
+
+func (s *redisStore) Load(name string) ([]byte, error) {
+	b, err := s.rdb.Get(context.Background(), s.prefix+name).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	return b, err
+}
+
+func (s *redisStore) Save(name string, blob []byte) error {
+	return s.rdb.Set(context.Background(), s.prefix+name, blob, 0).Err()
+}
+
+func (s *redisStore) Delete(name string) error {
+	return s.rdb.Del(context.Background(), s.prefix+name).Err()
+}
+
+func (s *redisStore) List() ([]string, error) {
+	ctx := context.Background()
+	var names []string
+	iter := s.rdb.Scan(ctx, 0, s.prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		names = append(names, strings.TrimPrefix(iter.Val(), s.prefix))
+	}
+	return names, iter.Err()
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package janitor 定期清理孤立的登录凭据和转换遗留的临时媒体文件
+package janitor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"bvtc/log"
+	"bvtc/tool/credential"
+)
+
+const (
+	defaultInterval    = time.Hour
+	defaultMediaMaxAge = 6 * time.Hour
+)
+
+// 转换过程中产生的临时文件
+var mediaExts = []string{".mp4", ".mp3", ".jpeg"}
+
+// Options 清理配置，零值使用默认值
+type Options struct {
+	Interval    time.Duration // 清理间隔
+	MediaMaxAge time.Duration // 临时媒体文件超过该时长视为遗留
+	MediaDir    string        // 临时媒体文件目录
+
+	// References 返回仍被会话引用的凭据名，为空时不清理凭据
+	References func() (map[string]bool, error)
+	// OnCredentialRemoved 孤立凭据删除后的回调，用于清理相关的 Redis 数据
+	OnCredentialRemoved func(name string)
+}
+
+// Stats 累计清理结果，通过健康检查接口暴露
+type Stats struct {
+	Runs               int       `json:"runs"`
+	LastRunAt          time.Time `json:"lastRunAt"`
+	LastDuration       string    `json:"lastDuration"`
+	CredentialsRemoved int       `json:"credentialsRemoved"`
+	RuntimeRemoved     int       `json:"runtimeRemoved"`
+	MediaRemoved       int       `json:"mediaRemoved"`
+	BytesReclaimed     int64     `json:"bytesReclaimed"`
+	Errors             int       `json:"errors"`
+}
+
+type janitor struct {
+	opts Options
+
+	mu    sync.Mutex
+	stats Stats
+	// 上一轮发现的孤立凭据，连续两轮都孤立才删除，避免误删正在登录的凭据
+	orphans map[string]bool
+}
+
+var j = &janitor{orphans: make(map[string]bool)}
+
+// Start 启动时立即清理一次，之后按间隔定期清理，ctx 结束后退出
+func Start(ctx context.Context, opts Options) {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	if opts.MediaMaxAge <= 0 {
+		opts.MediaMaxAge = defaultMediaMaxAge
+	}
+	j.opts = opts
+
+	// 启动时还没有登录流程在进行，孤立凭据可以直接删除
+	j.run(true)
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			j.run(false)
+		}
+	}
+}
+
+// GetStats 获取累计清理结果
+func GetStats() Stats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.stats
+}
+
+func (j *janitor) run(startup bool) {
+	start := time.Now()
+	var round Stats
+
+	round.CredentialsRemoved, round.Errors = j.sweepCredentials(startup)
+	if startup {
+		n, err := credential.PruneRuntime()
+		if err != nil {
+			log.Logger.Warn("fail to prune credential runtime files", log.Any("err", err))
+			round.Errors++
+		}
+		round.RuntimeRemoved = n
+	}
+	media, bytes, errs := sweepMedia(j.opts.MediaDir, j.opts.MediaMaxAge, start)
+	round.MediaRemoved, round.BytesReclaimed = media, bytes
+	round.Errors += errs
+
+	j.mu.Lock()
+	j.stats.Runs++
+	j.stats.LastRunAt = start
+	j.stats.LastDuration = time.Since(start).String()
+	j.stats.CredentialsRemoved += round.CredentialsRemoved
+	j.stats.RuntimeRemoved += round.RuntimeRemoved
+	j.stats.MediaRemoved += round.MediaRemoved
+	j.stats.BytesReclaimed += round.BytesReclaimed
+	j.stats.Errors += round.Errors
+	j.mu.Unlock()
+
+	log.Logger.Info("janitor finished",
+		log.Int("credentialsRemoved", round.CredentialsRemoved),
+		log.Int("runtimeRemoved", round.RuntimeRemoved),
+		log.Int("mediaRemoved", round.MediaRemoved),
+		log.Any("bytesReclaimed", round.BytesReclaimed),
+		log.Int("errors", round.Errors),
+		log.String("duration", time.Since(start).String()))
+}
+
+// sweepCredentials 删除 Redis 中已没有会话引用的凭据
+func (j *janitor) sweepCredentials(startup bool) (removed int, errs int) {
+	if j.opts.References == nil {
+		return 0, 0
+	}
+	names, err := credential.Names()
+	if err != nil {
+		log.Logger.Warn("fail to list credentials", log.Any("err", err))
+		return 0, 1
+	}
+	refs, err := j.opts.References()
+	if err != nil {
+		// Redis 不可用时无法判断是否孤立，本轮跳过
+		log.Logger.Warn("fail to collect referenced credentials", log.Any("err", err))
+		return 0, 1
+	}
+
+	orphans := make(map[string]bool)
+	for _, name := range names {
+		if refs[name] || credential.InUse(name) {
+			continue
+		}
+		if !startup && !j.orphans[name] {
+			orphans[name] = true
+			continue
+		}
+		if err := credential.Delete(name); err != nil {
+			log.Logger.Warn("fail to delete orphaned credential", log.String("name", name), log.Any("err", err))
+			errs++
+			continue
+		}
+		if j.opts.OnCredentialRemoved != nil {
+			j.opts.OnCredentialRemoved(name)
+		}
+		removed++
+	}
+	j.orphans = orphans
+	return removed, errs
+}
+
+// sweepMedia 删除超过 maxAge 的临时媒体文件和解压出的 ffmpeg
+func sweepMedia(dir string, maxAge time.Duration, now time.Time) (removed int, bytes int64, errs int) {
+	if dir == "" {
+		return 0, 0, 0
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, 0, 0
+	}
+	if err != nil {
+		log.Logger.Warn("fail to read media dir", log.String("dir", dir), log.Any("err", err))
+		return 0, 0, 1
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !isTempMedia(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || now.Sub(info.ModTime()) < maxAge {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil && !os.IsNotExist(err) {
+			log.Logger.Warn("fail to remove temp media", log.String("name", e.Name()), log.Any("err", err))
+			errs++
+			continue
+		}
+		removed++
+		bytes += info.Size()
+	}
+	return removed, bytes, errs
+}
+
+// isTempMedia 是否为转换流程产生的临时文件
+func isTempMedia(name string) bool {
+	if strings.HasPrefix(name, "ffmpeg_") {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range mediaExts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
@@ -22,6 +22,7 @@ package redis_pool
 
 import (
 	"bvtc/config"
+	"bvtc/constant"
 	"bvtc/log"
 	"context"
 	"fmt"
@@ -57,7 +58,23 @@ func GetRdb() *redis.Client {
 	return rdb
 }
 
-// 将 Redis 中的会话有效期延长至 7 天，并刷新标记
+// SessionIdleTimeout 会话空闲超时
+func SessionIdleTimeout() time.Duration {
+	if d := config.GetConfig().Security.Session.IdleTimeout; d > 0 {
+		return d
+	}
+	return constant.SessionIdleTimeout
+}
+
+// SessionAbsoluteTimeout 会话绝对超时
+func SessionAbsoluteTimeout() time.Duration {
+	if d := config.GetConfig().Security.Session.AbsoluteTimeout; d > 0 {
+		return d
+	}
+	return constant.SessionAbsoluteTimeout
+}
+
+// 登录成功后把 Redis 中的会话有效期延长为空闲超时，并记录最近访问时间
 func ExtendTimeForCookie(sid string) error {
 	if sid == "" {
 		return fmt.Errorf("sid is empty")
@@ -75,13 +92,24 @@ func ExtendTimeForCookie(sid string) error {
 		return fmt.Errorf("session not exists or expired")
 	}
 
-	ok, err := rdb.Expire(ctx, key, 7*24*time.Hour).Result()
+	// 绝对超时从登录完成时开始计算
+	now := time.Now().Format(time.RFC3339)
+	if err := rdb.HSet(ctx, key, "createdAt", now, "lastSeenAt", now).Err(); err != nil {
+		return fmt.Errorf("redis hset failed: %w", err)
+	}
+
+	ttl := SessionIdleTimeout()
+	ok, err := rdb.Expire(ctx, key, ttl).Result()
 	if err != nil {
 		return fmt.Errorf("redis expire failed: %w", err)
 	}
 	if !ok {
 		return fmt.Errorf("session expire refresh failed")
 	}
+	// 关联的账号列表跟随会话一起续期，不存在时忽略
+	if err := rdb.Expire(ctx, key+":accounts", ttl).Err(); err != nil {
+		return fmt.Errorf("redis expire accounts failed: %w", err)
+	}
 
 	return nil
 }
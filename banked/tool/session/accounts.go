@@ -0,0 +1,303 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"bvtc/tool/credential"
+	redis_pool "bvtc/tool/pool"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrAccountNotLinked 会话中没有关联该网易云账号
+var ErrAccountNotLinked = errors.New("account not linked to session")
+
+// LinkedAccount 会话中关联的一个网易云账号
+type LinkedAccount struct {
+	Uid        int64     `json:"uid"`
+	Nickname   string    `json:"nickname"`
+	AvatarUrl  string    `json:"avatarUrl"`
+	CookieFile string    `json:"cookieFile"`
+	LinkedAt   time.Time `json:"linkedAt"`
+}
+
+func accountsKey(sid string) string {
+	return "session:" + sid + ":accounts"
+}
+
+// AddAccount 关联账号，同一 uid 重复关联时覆盖，返回被替换掉的旧 cookie 文件
+func AddAccount(sid string, acc LinkedAccount) (string, error) {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if sid == "" || acc.Uid == 0 {
+		return "", fmt.Errorf("sid or uid is empty")
+	}
+	if rdb == nil {
+		return "", fmt.Errorf("redis client is nil")
+	}
+
+	old, err := GetAccount(sid, acc.Uid)
+	if err != nil && !errors.Is(err, ErrAccountNotLinked) {
+		return "", err
+	}
+	oldCookieFile := ""
+	if old != nil && old.CookieFile != acc.CookieFile {
+		oldCookieFile = old.CookieFile
+	}
+
+	if acc.LinkedAt.IsZero() {
+		acc.LinkedAt = time.Now()
+	}
+	b, err := json.Marshal(acc)
+	if err != nil {
+		return "", err
+	}
+	key := accountsKey(sid)
+	if err := rdb.HSet(rctx, key, strconv.FormatInt(acc.Uid, 10), b).Err(); err != nil {
+		return "", fmt.Errorf("redis HSet failed: %w", err)
+	}
+	// 账号列表与会话同时过期
+	ttl, err := rdb.TTL(rctx, "session:"+sid).Result()
+	if err != nil || ttl <= 0 {
+		ttl = 7 * 24 * time.Hour
+	}
+	if err := rdb.Expire(rctx, key, ttl).Err(); err != nil {
+		return "", fmt.Errorf("redis Expire failed: %w", err)
+	}
+	return oldCookieFile, nil
+}
+
+// GetAccount 获取会话中关联的指定账号
+func GetAccount(sid string, uid int64) (*LinkedAccount, error) {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return nil, fmt.Errorf("redis client is nil")
+	}
+	raw, err := rdb.HGet(rctx, accountsKey(sid), strconv.FormatInt(uid, 10)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrAccountNotLinked
+	}
+	if err != nil {
+		return nil, err
+	}
+	var acc LinkedAccount
+	if err := json.Unmarshal([]byte(raw), &acc); err != nil {
+		return nil, err
+	}
+	return &acc, nil
+}
+
+// ListAccounts 按关联时间列出会话中的所有账号
+func ListAccounts(sid string) ([]LinkedAccount, error) {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return nil, fmt.Errorf("redis client is nil")
+	}
+	raw, err := rdb.HGetAll(rctx, accountsKey(sid)).Result()
+	if err != nil {
+		return nil, err
+	}
+	accounts := make([]LinkedAccount, 0, len(raw))
+	for _, v := range raw {
+		var acc LinkedAccount
+		if err := json.Unmarshal([]byte(v), &acc); err != nil {
+			continue
+		}
+		accounts = append(accounts, acc)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].LinkedAt.Before(accounts[j].LinkedAt) })
+	return accounts, nil
+}
+
+// RemoveAccount 取消关联账号
+func RemoveAccount(sid string, uid int64) error {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return fmt.Errorf("redis client is nil")
+	}
+	return rdb.HDel(rctx, accountsKey(sid), strconv.FormatInt(uid, 10)).Err()
+}
+
+// DelAccounts 删除会话的所有关联账号，退出登录时调用
+func DelAccounts(sid string) error {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return fmt.Errorf("redis client is nil")
+	}
+	return rdb.Del(rctx, accountsKey(sid)).Err()
+}
+
+// SetActiveAccount 切换会话当前使用的账号
+func SetActiveAccount(sid string, acc LinkedAccount) error {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return fmt.Errorf("redis client is nil")
+	}
+	return rdb.HSet(rctx, "session:"+sid, map[string]interface{}{
+		"cookieFile": acc.CookieFile,
+		"uid":        strconv.FormatInt(acc.Uid, 10),
+	}).Err()
+}
+
+// ActiveUid 会话当前使用的账号，未登录或旧会话没有记录时返回 0
+func ActiveUid(sid string) int64 {
+	rdb := redis_pool.GetRdb()
+	if rdb == nil {
+		return 0
+	}
+	raw, err := rdb.HGet(redis_pool.GetRctx(), "session:"+sid, "uid").Result()
+	if err != nil {
+		return 0
+	}
+	uid, _ := strconv.ParseInt(raw, 10, 64)
+	return uid
+}
+
+// ResolveCookieFile 获取账号对应的 cookie 文件，uid 为 0 时使用会话当前账号
+func ResolveCookieFile(sid string, uid int64) (string, error) {
+	if uid == 0 {
+		cookieFile := GetCookieBySession(sid)
+		if cookieFile == "" {
+			return "", fmt.Errorf("session not found or expired")
+		}
+		return cookieFile, nil
+	}
+	acc, err := GetAccount(sid, uid)
+	if err != nil {
+		return "", err
+	}
+	return acc.CookieFile, nil
+}
+
+// 关联新账号时的二维码信息
+func pendingLinkKey(sid string) string {
+	return "qrcode:link:" + sid
+}
+
+// SetPendingLink 保存关联账号的二维码 UniKey 和新 cookie 文件
+func SetPendingLink(sid string, cookieFile string, uniKey string) error {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if sid == "" || cookieFile == "" || uniKey == "" {
+		return fmt.Errorf("sid, cookieFile or uniKey is empty")
+	}
+	if rdb == nil {
+		return fmt.Errorf("redis client is nil")
+	}
+	key := pendingLinkKey(sid)
+	if err := rdb.HSet(rctx, key, map[string]interface{}{
+		"cookieFile": cookieFile,
+		"uniKey":     uniKey,
+	}).Err(); err != nil {
+		return fmt.Errorf("redis HSet failed: %w", err)
+	}
+	return rdb.Expire(rctx, key, 2*time.Minute).Err()
+}
+
+// GetPendingLink 获取关联账号的二维码信息
+func GetPendingLink(sid string) (cookieFile string, uniKey string, err error) {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return "", "", fmt.Errorf("redis client is nil")
+	}
+	fields, err := rdb.HGetAll(rctx, pendingLinkKey(sid)).Result()
+	if err != nil {
+		return "", "", err
+	}
+	if fields["cookieFile"] == "" || fields["uniKey"] == "" {
+		return "", "", fmt.Errorf("pending link not found or expired")
+	}
+	return fields["cookieFile"], fields["uniKey"], nil
+}
+
+// delPendingLink 二维码信息仍属于 ARGV[1] 时才删除
+var delPendingLink = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "uniKey") == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// DelPendingLink 删除关联账号的二维码信息；用户已经重新生成二维码时保留新的信息
+func DelPendingLink(sid string, uniKey string) error {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return fmt.Errorf("redis client is nil")
+	}
+	return delPendingLink.Run(rctx, rdb, []string{pendingLinkKey(sid)}, uniKey).Err()
+}
+
+// BiliCredentialName 会话的哔哩哔哩凭据名，已存在时复用
+func BiliCredentialName(sid string) (string, error) {
+	if name := GetBiliCredential(sid); name != "" {
+		return name, nil
+	}
+	return "bili-" + GenerateSessionID(16) + ".json", nil
+}
+
+// GetBiliCredential 会话关联的哔哩哔哩凭据名，未登录时为空
+func GetBiliCredential(sid string) string {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return ""
+	}
+	name, _ := rdb.HGet(rctx, "session:"+sid, "biliCookie").Result()
+	return name
+}
+
+// SetBiliCredential 记录会话的哔哩哔哩凭据名
+func SetBiliCredential(sid string, name string) error {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return fmt.Errorf("redis client is nil")
+	}
+	return rdb.HSet(rctx, "session:"+sid, "biliCookie", name).Err()
+}
+
+// DelBiliCredential 删除会话的哔哩哔哩凭据
+func DelBiliCredential(sid string) error {
+	name := GetBiliCredential(sid)
+	if name == "" {
+		return nil
+	}
+	if err := credential.Delete(name); err != nil {
+		return err
+	}
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	return rdb.HDel(rctx, "session:"+sid, "biliCookie").Err()
+}
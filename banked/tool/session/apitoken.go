@@ -0,0 +1,284 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	redis_pool "bvtc/tool/pool"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 个人访问令牌的权限范围
+const (
+	ScopeTasksCreate   = "tasks:create"   // 创建上传任务（加入歌单随任务进行）
+	ScopeTasksRead     = "tasks:read"     // 查询任务状态和报告、读取视频合集列表
+	ScopePlaylistsRead = "playlists:read" // 读取歌单和歌单详情
+)
+
+// APITokenPrefix 令牌明文前缀，便于识别和密钥扫描
+const APITokenPrefix = "bvtc_"
+
+// ErrAPITokenNotFound 令牌不存在、已撤销或已过期
+var ErrAPITokenNotFound = errors.New("api token not found")
+
+// ValidScope 是否为支持的权限范围
+func ValidScope(scope string) bool {
+	switch scope {
+	case ScopeTasksCreate, ScopeTasksRead, ScopePlaylistsRead:
+		return true
+	}
+	return false
+}
+
+// APIToken 个人访问令牌，只保存明文的 sha256
+type APIToken struct {
+	Id         string
+	Name       string
+	Uid        int64
+	Sid        string // 令牌专用的无界面会话，保存令牌自己的凭据副本
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time // 零值表示永不过期
+	LastUsedAt time.Time
+}
+
+// HasScope 令牌是否具有指定权限
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func apiTokenKey(id string) string {
+	return "apitoken:" + id
+}
+
+func apiTokenHashKey(hash string) string {
+	return "apitoken:hash:" + hash
+}
+
+func accountTokensKey(uid int64) string {
+	return "account:tokens:" + strconv.FormatInt(uid, 10)
+}
+
+func hashAPIToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken 生成令牌并保存，返回只展示一次的明文
+func CreateAPIToken(tok APIToken) (raw string, saved APIToken, err error) {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return "", tok, fmt.Errorf("redis client is nil")
+	}
+	if tok.Uid == 0 || tok.Sid == "" {
+		return "", tok, fmt.Errorf("uid or sid is empty")
+	}
+
+	raw = APITokenPrefix + GenerateSessionID(32)
+	hash := hashAPIToken(raw)
+	tok.Id = GenerateSessionID(8)
+	tok.CreatedAt = time.Now()
+
+	fields := map[string]interface{}{
+		"name":      tok.Name,
+		"uid":       strconv.FormatInt(tok.Uid, 10),
+		"sid":       tok.Sid,
+		"scopes":    strings.Join(tok.Scopes, ","),
+		"hash":      hash,
+		"createdAt": tok.CreatedAt.Format(time.RFC3339),
+	}
+	if !tok.ExpiresAt.IsZero() {
+		fields["expiresAt"] = tok.ExpiresAt.Format(time.RFC3339)
+	}
+
+	pipe := rdb.TxPipeline()
+	pipe.HSet(rctx, apiTokenKey(tok.Id), fields)
+	pipe.Set(rctx, apiTokenHashKey(hash), tok.Id, 0)
+	pipe.SAdd(rctx, accountTokensKey(tok.Uid), tok.Id)
+	if !tok.ExpiresAt.IsZero() {
+		pipe.ExpireAt(rctx, apiTokenKey(tok.Id), tok.ExpiresAt)
+		pipe.ExpireAt(rctx, apiTokenHashKey(hash), tok.ExpiresAt)
+		pipe.ExpireAt(rctx, "session:"+tok.Sid, tok.ExpiresAt)
+	}
+	if _, err := pipe.Exec(rctx); err != nil {
+		return "", tok, err
+	}
+	return raw, tok, nil
+}
+
+// GetAPIToken 按 id 读取令牌
+func GetAPIToken(id string) (*APIToken, error) {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return nil, fmt.Errorf("redis client is nil")
+	}
+	fields, err := rdb.HGetAll(rctx, apiTokenKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrAPITokenNotFound
+	}
+	tok := &APIToken{
+		Id:   id,
+		Name: fields["name"],
+		Sid:  fields["sid"],
+	}
+	tok.Uid, _ = strconv.ParseInt(fields["uid"], 10, 64)
+	if fields["scopes"] != "" {
+		tok.Scopes = strings.Split(fields["scopes"], ",")
+	}
+	tok.CreatedAt, _ = time.Parse(time.RFC3339, fields["createdAt"])
+	tok.ExpiresAt, _ = time.Parse(time.RFC3339, fields["expiresAt"])
+	tok.LastUsedAt, _ = time.Parse(time.RFC3339, fields["lastUsedAt"])
+	return tok, nil
+}
+
+// touchAPIToken 记录存在时才写入 lastUsedAt
+var touchAPIToken = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return redis.call("HSET", KEYS[1], "lastUsedAt", ARGV[1])
+end
+return 0
+`)
+
+// LookupAPIToken 校验 Authorization 中的令牌明文，并记录使用时间
+func LookupAPIToken(raw string) (*APIToken, error) {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return nil, fmt.Errorf("redis client is nil")
+	}
+	if !strings.HasPrefix(raw, APITokenPrefix) {
+		return nil, ErrAPITokenNotFound
+	}
+	id, err := rdb.Get(rctx, apiTokenHashKey(hashAPIToken(raw))).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrAPITokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	tok, err := GetAPIToken(id)
+	if err != nil {
+		return nil, err
+	}
+	if !tok.ExpiresAt.IsZero() && time.Now().After(tok.ExpiresAt) {
+		return nil, ErrAPITokenNotFound
+	}
+	// 令牌可能同时被撤销，只在记录仍存在时更新，避免重新创建出不过期的残缺记录
+	_ = touchAPIToken.Run(rctx, rdb, []string{apiTokenKey(id)}, time.Now().Format(time.RFC3339)).Err()
+	return tok, nil
+}
+
+// ListAPITokens 列出账号的令牌，按创建时间倒序；已过期的顺便移除
+func ListAPITokens(uid int64) ([]APIToken, error) {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return nil, fmt.Errorf("redis client is nil")
+	}
+	ids, err := rdb.SMembers(rctx, accountTokensKey(uid)).Result()
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]APIToken, 0, len(ids))
+	for _, id := range ids {
+		tok, err := GetAPIToken(id)
+		if errors.Is(err, ErrAPITokenNotFound) {
+			rdb.SRem(rctx, accountTokensKey(uid), id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *tok)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+// DeleteAPIToken 删除令牌记录，令牌会话和凭据由调用方清理
+func DeleteAPIToken(tok *APIToken) error {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return fmt.Errorf("redis client is nil")
+	}
+	hash, _ := rdb.HGet(rctx, apiTokenKey(tok.Id), "hash").Result()
+	pipe := rdb.TxPipeline()
+	pipe.Del(rctx, apiTokenKey(tok.Id))
+	if hash != "" {
+		pipe.Del(rctx, apiTokenHashKey(hash))
+	}
+	pipe.SRem(rctx, accountTokensKey(tok.Uid), tok.Id)
+	_, err := pipe.Exec(rctx)
+	return err
+}
+
+// IsTokenSession 会话是否为个人访问令牌创建的无界面会话
+func IsTokenSession(sid string) bool {
+	rdb := redis_pool.GetRdb()
+	if rdb == nil {
+		return false
+	}
+	v, _ := rdb.HGet(redis_pool.GetRctx(), "session:"+sid, "apiToken").Result()
+	return v == "true"
+}
+
+// NewTokenSession 为令牌创建不过期的无界面会话，令牌设置了有效期时由 CreateAPIToken 设置过期时间
+func NewTokenSession(cookieFile string, uid int64) (string, error) {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return "", fmt.Errorf("redis client is nil")
+	}
+	sid := GenerateSessionID(16)
+	now := time.Now().Format(time.RFC3339)
+	err := rdb.HSet(rctx, "session:"+sid, map[string]interface{}{
+		"cookieFile": cookieFile,
+		"uid":        strconv.FormatInt(uid, 10),
+		"createdAt":  now,
+		"apiToken":   "true",
+	}).Err()
+	if err != nil {
+		return "", err
+	}
+	return sid, nil
+}
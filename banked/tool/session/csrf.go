@@ -0,0 +1,64 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"crypto/subtle"
+	"fmt"
+
+	redis_pool "bvtc/tool/pool"
+)
+
+// CSRFHeader 前端提交 CSRF token 的请求头，登录和检查登录状态时也通过该响应头下发
+const CSRFHeader = "X-CSRF-Token"
+
+// IssueCSRFToken 获取会话的 CSRF token，没有时生成并保存在会话中
+func IssueCSRFToken(sid string) (string, error) {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return "", fmt.Errorf("redis client is nil")
+	}
+	key := "session:" + sid
+	token, _ := rdb.HGet(rctx, key, "csrfToken").Result()
+	if token != "" {
+		return token, nil
+	}
+	token = GenerateSessionID(32)
+	if err := rdb.HSet(rctx, key, "csrfToken", token).Err(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// VerifyCSRFToken 校验请求携带的 token 是否与会话中的一致
+func VerifyCSRFToken(sid string, token string) bool {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil || sid == "" || token == "" {
+		return false
+	}
+	expected, err := rdb.HGet(rctx, "session:"+sid, "csrfToken").Result()
+	if err != nil || expected == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(token)) == 1
+}
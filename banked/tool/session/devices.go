@@ -0,0 +1,141 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	redis_pool "bvtc/tool/pool"
+)
+
+// SessionInfo 一个登录设备的会话信息
+type SessionInfo struct {
+	Sid        string
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+}
+
+// PublicID 会话对外展示的标识，不能反推出 SessionId
+func PublicID(sid string) string {
+	sum := sha256.Sum256([]byte(sid))
+	return hex.EncodeToString(sum[:8])
+}
+
+// RecordClient 记录会话的客户端 UA 和 IP
+func RecordClient(sid string, userAgent string, ip string) error {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return fmt.Errorf("redis client is nil")
+	}
+	return rdb.HSet(rctx, "session:"+sid, map[string]interface{}{
+		"userAgent": userAgent,
+		"ip":        ip,
+	}).Err()
+}
+
+// Touch 滑动续期：记录访问时间和 IP，并把会话和关联账号的过期时间延长为 ttl
+func Touch(sid string, ip string, ttl time.Duration) error {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return fmt.Errorf("redis client is nil")
+	}
+	key := "session:" + sid
+	pipe := rdb.TxPipeline()
+	pipe.HSet(rctx, key, map[string]interface{}{
+		"lastSeenAt": time.Now().Format(time.RFC3339),
+		"ip":         ip,
+	})
+	pipe.Expire(rctx, key, ttl)
+	pipe.Expire(rctx, accountsKey(sid), ttl)
+	_, err := pipe.Exec(rctx)
+	return err
+}
+
+func accountSessionsKey(uid int64) string {
+	return "account:sessions:" + strconv.FormatInt(uid, 10)
+}
+
+// IndexSession 记录账号在哪些会话中登录，用于设备列表和全部退出
+func IndexSession(uid int64, sid string) error {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return fmt.Errorf("redis client is nil")
+	}
+	return rdb.SAdd(rctx, accountSessionsKey(uid), sid).Err()
+}
+
+// UnindexSession 会话删除后从账号的会话列表中移除
+func UnindexSession(uid int64, sid string) error {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return fmt.Errorf("redis client is nil")
+	}
+	return rdb.SRem(rctx, accountSessionsKey(uid), sid).Err()
+}
+
+// AccountSessions 列出账号仍然有效的会话，按最近访问时间倒序；已过期的会话顺便移除
+func AccountSessions(uid int64) ([]SessionInfo, error) {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return nil, fmt.Errorf("redis client is nil")
+	}
+	sids, err := rdb.SMembers(rctx, accountSessionsKey(uid)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]SessionInfo, 0, len(sids))
+	for _, sid := range sids {
+		fields, err := rdb.HGetAll(rctx, "session:"+sid).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) == 0 {
+			_ = UnindexSession(uid, sid)
+			continue
+		}
+		info := SessionInfo{
+			Sid:       sid,
+			UserAgent: fields["userAgent"],
+			IP:        fields["ip"],
+		}
+		info.CreatedAt, _ = time.Parse(time.RFC3339, fields["createdAt"])
+		info.LastSeenAt, _ = time.Parse(time.RFC3339, fields["lastSeenAt"])
+		if info.LastSeenAt.IsZero() {
+			info.LastSeenAt = info.CreatedAt
+		}
+		sessions = append(sessions, info)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+	return sessions, nil
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2025 Youzill
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	redis_pool "bvtc/tool/pool"
+)
+
+// 登录已失效的网易云凭据，field 为 cookie 文件名，value 为标记时间
+const expiredCredentialsKey = "credential:expired"
+
+func pausedJobsKey(uid int64) string {
+	return "account:paused:" + strconv.FormatInt(uid, 10)
+}
+
+// MarkCredentialExpired 标记凭据登录已失效，并暂停该账号后续的任务。
+// 暂停只拒绝新建任务，已在运行的任务继续执行；重新登录或健康检查发现该账号仍有有效凭据时恢复
+func MarkCredentialExpired(cookieFile string, uid int64) error {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return fmt.Errorf("redis client is nil")
+	}
+	now := time.Now().Format(time.RFC3339)
+	pipe := rdb.TxPipeline()
+	pipe.HSet(rctx, expiredCredentialsKey, cookieFile, now)
+	if uid != 0 {
+		pipe.Set(rctx, pausedJobsKey(uid), now, 0)
+	}
+	_, err := pipe.Exec(rctx)
+	return err
+}
+
+// CredentialExpired 凭据是否已被健康检查标记为失效
+func CredentialExpired(cookieFile string) bool {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil || cookieFile == "" {
+		return false
+	}
+	ok, _ := rdb.HExists(rctx, expiredCredentialsKey, cookieFile).Result()
+	return ok
+}
+
+// ClearCredentialExpired 移除失效标记，凭据被删除后调用
+func ClearCredentialExpired(cookieFile string) error {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return fmt.Errorf("redis client is nil")
+	}
+	return rdb.HDel(rctx, expiredCredentialsKey, cookieFile).Err()
+}
+
+// ExpiredCredentials 所有被标记为失效的凭据
+func ExpiredCredentials() ([]string, error) {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return nil, fmt.Errorf("redis client is nil")
+	}
+	return rdb.HKeys(rctx, expiredCredentialsKey).Result()
+}
+
+// AccountJobsPaused 账号的任务是否因登录失效被暂停
+func AccountJobsPaused(uid int64) bool {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil || uid == 0 {
+		return false
+	}
+	n, _ := rdb.Exists(rctx, pausedJobsKey(uid)).Result()
+	return n > 0
+}
+
+// ResumeAccountJobs 账号重新登录后恢复任务
+func ResumeAccountJobs(uid int64) error {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return fmt.Errorf("redis client is nil")
+	}
+	return rdb.Del(rctx, pausedJobsKey(uid)).Err()
+}
+
+// ActiveSessions 列出 Redis 中所有会话的 SessionId
+func ActiveSessions() ([]string, error) {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return nil, fmt.Errorf("redis client is nil")
+	}
+	var sids []string
+	iter := rdb.Scan(rctx, 0, "session:*", 100).Iterator()
+	for iter.Next(rctx) {
+		sid := strings.TrimPrefix(iter.Val(), "session:")
+		// 跳过 session:<sid>:accounts 等附属 key
+		if sid == "" || strings.Contains(sid, ":") {
+			continue
+		}
+		sids = append(sids, sid)
+	}
+	return sids, iter.Err()
+}
+
+// ReferencedCredentials 收集 Redis 中仍被引用的凭据名：会话当前账号、关联账号、哔哩哔哩登录和待关联的二维码
+func ReferencedCredentials() (map[string]bool, error) {
+	rdb := redis_pool.GetRdb()
+	rctx := redis_pool.GetRctx()
+	if rdb == nil {
+		return nil, fmt.Errorf("redis client is nil")
+	}
+	refs := make(map[string]bool)
+
+	sids, err := ActiveSessions()
+	if err != nil {
+		return nil, err
+	}
+	for _, sid := range sids {
+		fields, err := rdb.HMGet(rctx, "session:"+sid, "cookieFile", "biliCookie").Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range fields {
+			if name, ok := f.(string); ok && name != "" {
+				refs[name] = true
+			}
+		}
+		accounts, err := ListAccounts(sid)
+		if err != nil {
+			return nil, err
+		}
+		for _, acc := range accounts {
+			refs[acc.CookieFile] = true
+		}
+	}
+
+	iter := rdb.Scan(rctx, 0, pendingLinkKey("*"), 100).Iterator()
+	for iter.Next(rctx) {
+		name, err := rdb.HGet(rctx, iter.Val(), "cookieFile").Result()
+		if err == nil && name != "" {
+			refs[name] = true
+		}
+	}
+	return refs, iter.Err()
+}
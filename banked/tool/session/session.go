@@ -26,6 +26,8 @@ import (
 	"encoding/hex"
 	"fmt"
 	"time"
+
+	"github.com/redis/go-redis/v9"
 )
 
 func GenerateSessionID(length int) string {
@@ -115,7 +117,7 @@ func GetQrcodeUniKeyBySession(sid string) (string, error) {
 }
 
 // 删除二维码 UniKey
-func DelQrcodeUniKey(sid string) error {
+func DelQrcodeUniKey(sid string, uniKey string) error {
 	rdb := redis_pool.GetRdb()
 	rctx := redis_pool.GetRctx()
 	if sid == "" {
@@ -125,10 +127,17 @@ func DelQrcodeUniKey(sid string) error {
 		return fmt.Errorf("redis client is nil")
 	}
 
+	// 只删除仍属于该二维码的 UniKey，重新生成的二维码不受影响
 	key := "qrcode:" + sid
-	_, err := rdb.Del(rctx, key).Result()
-	if err != nil {
+	if err := delQrcodeUniKey.Run(rctx, rdb, []string{key}, uniKey).Err(); err != nil {
 		return fmt.Errorf("del qrcode key failed: %w", err)
 	}
 	return nil
 }
+
+var delQrcodeUniKey = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
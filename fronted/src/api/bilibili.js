@@ -9,3 +9,21 @@ export const uploadToNetCloudByBVID = async (bvidList, splaylist = false, pid =
 	});
 	return response.data;
 };
+
+// 哔哩哔哩登录状态
+export const getBiliLoginStatus = async () => {
+	const response = await axiosInstance.get("/bilibili/login/check");
+	return response.data;
+};
+
+// 退出哔哩哔哩登录
+export const biliLogout = async () => {
+	const response = await axiosInstance.post("/bilibili/logout");
+	return response.data;
+};
+
+// 清除标题建议缓存，重新生成前调用
+export const invalidateSuggestion = async (bvids) => {
+	const response = await axiosInstance.post("/bilibili/suggest-title/invalidate", { bvids });
+	return response.data;
+};
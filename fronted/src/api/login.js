@@ -52,3 +52,18 @@ export const checkLoginStatus = async () => {
 		throw error;
 	}
 };
+
+// WebSocket 被代理拦截时使用 SSE 获取扫码状态，事件名为 status
+export const createLoginQrcodeEventSource = () => {
+	const basePath = process.env.NODE_ENV === "development" ? "http://localhost:8081/bvtc/api" : axiosInstance.defaults.baseURL || "";
+	return new EventSource(`${basePath}/netcloud/login/verify?transport=sse`, { withCredentials: true });
+};
+
+// 长轮询扫码状态：状态与 since 不同时立即返回，否则最多等待约 25 秒
+export const pollLoginQrcodeStatus = async (since = 0) => {
+	const response = await axiosInstance.get("/netcloud/login/verify", {
+		params: { transport: "poll", since },
+		timeout: 35000,
+	});
+	return response.data;
+};
@@ -1,12 +1,103 @@
 import axiosInstance from "../axiosInstance";
 
-// 获取歌单列表
+// 获取歌单列表（分页拉取全部，仅保留自己创建、可以添加歌曲的歌单）
 export const getPlaylists = async () => {
 	try {
-		const response = await axiosInstance.get("/netcloud/playlist");
-		return response.data;
+		const playlists = [];
+		let offset = 0;
+		for (;;) {
+			const response = await axiosInstance.get("/netcloud/playlist", { params: { offset } });
+			if (response.data.code !== 200) {
+				return response.data;
+			}
+			const page = response.data.data;
+			playlists.push(...(page.playlists || []).filter((p) => p.owned));
+			if (!page.more) {
+				break;
+			}
+			offset = page.nextOffset;
+		}
+		return { code: 200, data: playlists };
 	} catch (error) {
 		// console.error("获取歌单列表失败:", error);
 		throw error;
 	}
 };
+
+// 获取歌单详情（包含已有歌曲）
+export const getPlaylistDetail = async (pid) => {
+	const response = await axiosInstance.get(`/netcloud/playlist/${pid}`);
+	return response.data;
+};
+
+// 发送短信验证码；被风控时 data.verify 给出下一步操作
+export const sendSmsCode = async (phone, ctcode = 86) => {
+	const response = await axiosInstance.post("/netcloud/login/sms", { phone, ctcode }, { validateStatus: () => true });
+	return response.data;
+};
+
+// 短信验证码登录
+export const verifySmsCode = async (phone, captcha, ctcode = 86) => {
+	const response = await axiosInstance.post("/netcloud/login/sms/verify", { phone, captcha, ctcode }, { validateStatus: () => true });
+	return response.data;
+};
+
+// 手机号/邮箱 + 密码登录
+export const passwordLogin = async (account, password, ctcode = 86) => {
+	const response = await axiosInstance.post("/netcloud/login/password", { account, password, ctcode }, { validateStatus: () => true });
+	return response.data;
+};
+
+// 会话中关联的网易云账号
+export const getAccounts = async () => {
+	const response = await axiosInstance.get("/netcloud/accounts");
+	return response.data;
+};
+
+// 切换当前账号
+export const selectAccount = async (uid) => {
+	const response = await axiosInstance.post("/netcloud/accounts/select", { uid });
+	return response.data;
+};
+
+// 取消关联账号
+export const removeAccount = async (uid) => {
+	const response = await axiosInstance.post("/netcloud/accounts/remove", { uid });
+	return response.data;
+};
+
+// 当前账号的登录设备
+export const getSessions = async () => {
+	const response = await axiosInstance.get("/netcloud/sessions");
+	return response.data;
+};
+
+// 撤销某个登录设备
+export const revokeSession = async (id) => {
+	const response = await axiosInstance.post("/netcloud/sessions/revoke", { id });
+	return response.data;
+};
+
+// 撤销所有其他登录设备
+export const revokeAllSessions = async (includeCurrent = false) => {
+	const response = await axiosInstance.post("/netcloud/sessions/revoke-all", { includeCurrent });
+	return response.data;
+};
+
+// 个人访问令牌列表
+export const getTokens = async () => {
+	const response = await axiosInstance.get("/netcloud/tokens");
+	return response.data;
+};
+
+// 生成个人访问令牌，明文只在返回结果中出现一次
+export const createToken = async (name, scopes, expiresInDays = 0) => {
+	const response = await axiosInstance.post("/netcloud/tokens", { name, scopes, expiresInDays });
+	return response.data;
+};
+
+// 撤销个人访问令牌
+export const revokeToken = async (id) => {
+	const response = await axiosInstance.post("/netcloud/tokens/revoke", { id });
+	return response.data;
+};
@@ -10,10 +10,17 @@ const axiosInstance = axios.create({
 	},
 });
 
+// 登录和检查登录状态时后端通过响应头下发的 CSRF token，非 GET 请求需要带上
+let csrfToken = "";
+
 // 添加请求拦截器
 axiosInstance.interceptors.request.use(
 	(config) => {
 		// 在发送请求之前做些什么
+		const method = (config.method || "get").toLowerCase();
+		if (csrfToken && method !== "get" && method !== "head") {
+			config.headers["X-CSRF-Token"] = csrfToken;
+		}
 		return config;
 	},
 	(error) => {
@@ -25,7 +32,13 @@ axiosInstance.interceptors.request.use(
 
 // 添加响应拦截器处理错误
 axiosInstance.interceptors.response.use(
-	(response) => response,
+	(response) => {
+		const token = response.headers["x-csrf-token"];
+		if (token) {
+			csrfToken = token;
+		}
+		return response;
+	},
 	(error) => {
 		// console.error("请求失败:", error);
 		if (error.code === "ERR_NETWORK") {
@@ -4,6 +4,8 @@ import { UserOutlined, EyeOutlined, EyeInvisibleOutlined, GithubOutlined } from
 import { useNavigate } from "react-router-dom";
 import axiosInstance from "../axiosInstance";
 import { checkLoginStatus } from "../api/login";
+import { getPlaylists } from "../api/netease";
+import { invalidateSuggestion } from "../api/bilibili";
 
 const BilibiliPage = () => {
 	const [videoId, setVideoId] = useState("");
@@ -47,7 +49,7 @@ const BilibiliPage = () => {
 			let receivedAny = false;
 			try {
 				const base = axiosInstance.defaults.baseURL || "/api";
-				const url = `${base}/bilibili/suggest-title-batch/stream?bvids=${encodeURIComponent(selectedVideos.join(","))}`;
+				const url = `${base}/bilibili/suggest-title-batch/stream?bvids=${encodeURIComponent(selectedVideos.join(","))}&verify=true`;
 				const es = new EventSource(url);
 
 				es.addEventListener("open", () => {
@@ -57,7 +59,13 @@ const BilibiliPage = () => {
 				const handleProgress = (ev) => {
 					try {
 						const data = JSON.parse(ev.data || "{}");
-						const { bvid, suggestedTitle, error } = data || {};
+						const { bvid, error, verification } = data || {};
+						// 曲库验证通过时使用曲库中的歌名
+						const verified = verification?.verified ? verification.candidates?.[0] : null;
+						const suggestedTitle = verified ? verification.title : data?.suggestedTitle;
+						if (bvid && verified) {
+							setMatchedSongs((prev) => ({ ...prev, [bvid]: verified }));
+						}
 						if (!bvid && Array.isArray(data?.results)) {
 							// 兼容聚合结构（防旧格式）
 							const map = {};
@@ -93,6 +101,17 @@ const BilibiliPage = () => {
 					}
 				};
 				es.addEventListener("progress", handleProgress);
+				// 大模型生成中的部分结果，最终结果以 progress 为准
+				es.addEventListener("partial", (ev) => {
+					try {
+						const { bvid, text } = JSON.parse(ev.data || "{}");
+						if (bvid && text) {
+							setTitleOverride((prev) => ({ ...prev, [bvid]: text }));
+						}
+					} catch {
+						/* ignore */
+					}
+				});
 				// 某些代理会把未命名事件当默认 message 发
 				es.onmessage = handleProgress;
 
@@ -118,18 +137,29 @@ const BilibiliPage = () => {
 	const regenerateSuggestion = async (bvid) => {
 		if (!bvid) return;
 		setTitleSuggesting(true);
+		try {
+			// 先清除缓存，否则会直接返回上次的建议
+			await invalidateSuggestion([bvid]);
+		} catch (e) {
+			// 清除失败时仍然请求，可能拿到缓存结果
+		}
 		return new Promise((resolve, reject) => {
 			let receivedAny = false;
 			try {
 				const base = axiosInstance.defaults.baseURL || "/api";
-				const url = `${base}/bilibili/suggest-title-batch/stream?bvids=${encodeURIComponent(bvid)}`;
+				const url = `${base}/bilibili/suggest-title-batch/stream?bvids=${encodeURIComponent(bvid)}&verify=true`;
 				const es = new EventSource(url);
 
 				const handleSingleProgress = (ev) => {
 					try {
 						const data = JSON.parse(ev.data || "{}");
-						if (data?.bvid === bvid && data?.suggestedTitle) {
-							setTitleOverride((prev) => ({ ...prev, [bvid]: data.suggestedTitle }));
+						const verified = data?.verification?.verified ? data.verification.candidates?.[0] : null;
+						if (data?.bvid === bvid && verified) {
+							setMatchedSongs((prev) => ({ ...prev, [bvid]: verified }));
+						}
+						const suggestedTitle = verified ? data.verification.title : data?.suggestedTitle;
+						if (data?.bvid === bvid && suggestedTitle) {
+							setTitleOverride((prev) => ({ ...prev, [bvid]: suggestedTitle }));
 							// 标记该bvid已获取AI建议
 							setSuggestedBvids((prev) => new Set([...prev, bvid]));
 						}
@@ -168,6 +198,7 @@ const BilibiliPage = () => {
 	const [titleOverride, setTitleOverride] = useState({}); // { bvid: title }
 	const [titleSuggesting, setTitleSuggesting] = useState(false);
 	const [suggestedBvids, setSuggestedBvids] = useState(new Set()); // 追踪已获取AI建议的bvid
+	const [matchedSongs, setMatchedSongs] = useState({}); // { bvid: 网易云曲库中匹配到的歌曲 }
 
 	const showError = (msg) => {
 		messageApi.error(msg);
@@ -237,9 +268,9 @@ const BilibiliPage = () => {
 				return;
 			}
 
-			const response = await axiosInstance.get("netcloud/playlist");
-			if (response.data.code === 200) {
-				setPlaylists(response.data.data);
+			const response = await getPlaylists();
+			if (response.code === 200) {
+				setPlaylists(response.data);
 				setIsModalVisible(true);
 			} else {
 				message.error("获取歌单列表失败");
@@ -912,6 +943,11 @@ const BilibiliPage = () => {
 													{suggestedBvids.has(bvid) ? "重新生成" : "AI建议"}
 												</Button>
 											</div>
+											{matchedSongs[bvid] && (
+												<div style={{ fontSize: 12, color: "#52c41a", marginTop: 4 }}>
+													已匹配：{matchedSongs[bvid].name} — {(matchedSongs[bvid].artists || []).join(" / ")}
+												</div>
+											)}
 										</div>
 									);
 								})}